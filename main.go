@@ -2,12 +2,21 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
+	"log/slog"
+	"math/big"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/MrTeeett/pgx-v5-pool-examples/pgx_demo"
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 func main() {
@@ -35,13 +44,138 @@ func main() {
 		log.Fatalf("bootstrapEnsureSchema: %v", err)
 	}
 
-	// ТЕПЕРЬ поднимаем пул и спокойно готовим prepared в AfterConnect
-	pool, err := pgx_demo.BuildPool(rootCtx, dsn)
+	// ТЕПЕРЬ поднимаем пул и спокойно готовим prepared в AfterConnect.
+	// WithMetrics подключает сборщик метрик пула (длительности Acquire для p99).
+	metrics := pgx_demo.NewPoolMetrics("main")
+	// Структурированные логи pgx через slog: запросы и события пула на Debug, медленные (>200ms) — Warn,
+	// ошибки — Error. Уровень вывода — PGLOG=debug|info|warn|error (по умолчанию warn).
+	var logLevel slog.Level = slog.LevelWarn
+	if v := os.Getenv("PGLOG"); v != "" {
+		if err := logLevel.UnmarshalText([]byte(v)); err != nil {
+			log.Fatalf("PGLOG: %v", err)
+		}
+	}
+	pgLog := pgx_demo.NewSlogAdapter(pgx_demo.SlogOptions{
+		Logger:             slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})),
+		QueryLevel:         slog.LevelDebug,
+		PoolLevel:          slog.LevelDebug,
+		SlowQueryThreshold: 200 * time.Millisecond,
+	})
+	// Медленные запросы (>500ms): SQL, имя выражения, отпечаток аргументов и EXPLAIN-план, последние 100.
+	slowQueries := pgx_demo.NewSlowQueryDetector(500*time.Millisecond, 100)
+	defer slowQueries.Close()
+	// Политика здоровья: соединение с изменёнными GUC, после фатальной ошибки или 10000 запросов не возвращается в пул.
+	health := &pgx_demo.HealthPolicy{MaxQueries: 10000}
+	// Circuit breaker: после 5 ошибок соединения подряд новые подключения отклоняются сразу (ErrCircuitOpen),
+	// раз в 5 секунд — проверочный pool.Ping. Состояние — в логе и в /metrics.
+	breaker := pgx_demo.NewCircuitBreaker(pgx_demo.BreakerOptions{
+		OnStateChange: func(from, to pgx_demo.BreakerState) { log.Printf("circuit breaker: %s -> %s", from, to) },
+	})
+	metrics.TrackBreaker(breaker)
+	poolOpts := []pgx_demo.PoolOption{pgx_demo.WithMetrics(metrics), pgx_demo.WithSlog(pgLog), pgx_demo.WithTracer(slowQueries),
+		pgx_demo.WithHealthPolicy(health), pgx_demo.WithCircuitBreaker(breaker)}
+	// Учёт выданных соединений для корректного завершения: кто держит соединение и какой запрос выполняет.
+	shutdown := pgx_demo.NewShutdownTracker(pgx_demo.ShutdownOptions{})
+	poolOpts = append(poolOpts, pgx_demo.WithShutdownTracker(shutdown))
+	// PGFAILOVER=1 — для multi-host DSN (postgres://u:p@db1,db2/app): соединения, оказавшиеся на standby,
+	// выбрасываются в BeforeAcquire, пул переподключается к новому primary.
+	if os.Getenv("PGFAILOVER") != "" {
+		poolOpts = append(poolOpts, pgx_demo.WithFailover(pgx_demo.FailoverOptions{
+			OnEvent: func(e pgx_demo.FailoverEvent) {
+				log.Printf("failover: %s host=%s prev=%s pid=%d err=%v", e.Kind, e.Host, e.PrevHost, e.PID, e.Err)
+			},
+		}))
+	}
+	// PGRESET=always|changed — сбрасывать состояние сессии (SET, SET ROLE, LISTEN, advisory-блокировки, temp-таблицы)
+	// при возврате соединения в пул: при каждом возврате или только после замеченного SET/RESET.
+	switch os.Getenv("PGRESET") {
+	case "":
+	case "always":
+		poolOpts = append(poolOpts, pgx_demo.WithSessionReset(pgx_demo.SessionReset{Mode: pgx_demo.ResetAlways}))
+	case "changed":
+		poolOpts = append(poolOpts, pgx_demo.WithSessionReset(pgx_demo.SessionReset{Mode: pgx_demo.ResetIfChanged}))
+	default:
+		log.Fatalf("PGRESET: want always or changed, got %q", os.Getenv("PGRESET"))
+	}
+	// PGPASSWORD_FILE — пароль из файла-секрета вместо DSN: перечитывается при изменении, соединения
+	// со старым паролем выбрасываются при следующей выдаче, простаивающие — после ротации (creds.Run).
+	var creds *pgx_demo.CredentialRotator
+	if path := os.Getenv("PGPASSWORD_FILE"); path != "" {
+		creds = pgx_demo.NewCredentialRotator(pgx_demo.FileCredentials(path))
+		creds.OnRotate = func() { log.Printf("credentials rotated: %s", path) }
+		poolOpts = append(poolOpts, pgx_demo.WithCredentials(creds))
+	}
+	// PGTRACE=1 — печатать спан каждого запроса/батча/prepare/connect (имя выражения, SQLSTATE, строки, длительность).
+	if os.Getenv("PGTRACE") != "" {
+		poolOpts = append(poolOpts, pgx_demo.WithTracer(pgx_demo.NewSpanTracer(pgx_demo.SpanRecorderFunc(func(s pgx_demo.Span) {
+			log.Printf("span %s %s rows=%v sqlstate=%v err=%v", s.Name, s.Duration(),
+				s.Attrs[pgx_demo.AttrRowsAffected], s.Attrs[pgx_demo.AttrDBStatusCode], s.Err)
+		}), nil)))
+	}
+	pool, err := pgx_demo.BuildPool(rootCtx, dsn, poolOpts...)
 	if err != nil {
 		log.Fatalf("buildPool failed: %v", err)
 	}
-	defer pool.Close()
+	// Вместо pool.Close(): новые Acquire отклоняются сразу, выданные соединения ждём до 10 секунд,
+	// затем их запросы отменяются через CancelRequest, а прерванное попадает в лог.
+	var shutdownOnce sync.Once
+	closePool := func() {
+		shutdownOnce.Do(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			report, err := shutdown.Shutdown(ctx, pool)
+			log.Printf("Pool: закрыт за %s, прервано соединений: %d, err=%v", report.Waited, len(report.Aborted), err)
+		})
+	}
+	defer closePool()
+	// SIGTERM (остановка контейнера) и Ctrl+C: текущий шаг доделывается, следующий не начинается,
+	// main возвращается штатно — отложенные closePool, остановка метрик и HTTP-сервера выполняются, код выхода 0.
+	// Если шаг не закончился за 10 секунд, пул закрывается сразу: его запросы отменяются (шаг завершится ошибкой).
+	sigCtx, stopSignals := signal.NotifyContext(rootCtx, os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+	go func() {
+		<-sigCtx.Done()
+		time.Sleep(10 * time.Second)
+		closePool()
+	}()
+	stopRequested := func() bool {
+		if sigCtx.Err() == nil {
+			return false
+		}
+		log.Println("получен сигнал остановки: завершаем демонстрацию")
+		return true
+	}
+
+	// Метрики пула в формате Prometheus: снимок pool.Stat() раз в 10 секунд,
+	// HTTP-эндпоинт — только если задан METRICS_ADDR (например, ":9187"):
+	// /metrics — метрики пула, /debug/slow-queries — образцы медленных запросов (JSON).
+	metricsCtx, stopMetrics := context.WithCancel(rootCtx)
+	defer stopMetrics()
+	go metrics.Run(metricsCtx, pool, 10*time.Second)
+	go breaker.Run(metricsCtx, pool)
+	if creds != nil {
+		go creds.Run(metricsCtx, pool, time.Minute)
+	}
+	if addr := os.Getenv("METRICS_ADDR"); addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics)
+		mux.Handle("/debug/slow-queries", slowQueries)
+		srv := &http.Server{Addr: addr, Handler: mux}
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("metrics server: %v", err)
+			}
+		}()
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_ = srv.Shutdown(ctx)
+		}()
+	}
 
+	if stopRequested() {
+		return
+	}
 	// 2) Явный health-check: Pool.Ping берет коннект из пула, вызывает Conn.Ping и возвращает его обратно.
 	// Выполняем с коротким таймаутом — если БД недоступна, быстро узнаем.
 	if err := func() error {
@@ -53,8 +187,11 @@ func main() {
 	}
 	log.Println("Ping OK — база отвечает")
 
-	// 3) Подготовим базу (DDL). Можно держать это в миграциях (goose/tern/etc.),
-	// тут — компактно для демонстрации.
+	if stopRequested() {
+		return
+	}
+	// 3) Подготовим базу: те же версионные миграции (pgx_demo/migrations), но через соединение из пула.
+	// Повторный запуск безопасен — применённые версии записаны в schema_migrations.
 	if err := func() error {
 		ctx, cancel := context.WithTimeout(rootCtx, 5*time.Second)
 		defer cancel()
@@ -63,6 +200,9 @@ func main() {
 		log.Fatalf("ensureSchema: %v", err)
 	}
 
+	if stopRequested() {
+		return
+	}
 	// 4) Регистрация/логин пользователя с транзакцией.
 	email := "alice@example.com"
 	name := "Alice"
@@ -74,6 +214,9 @@ func main() {
 	}
 	log.Printf("Пользователь id=%d готов\n", userID)
 
+	if stopRequested() {
+		return
+	}
 	// 5) Гарантируем аккаунт и читаем баланс (Numeric через pgtype).
 	if err := pgx_demo.EnsureAccount(rootCtx, pool, userID); err != nil {
 		log.Fatalf("ensureAccount: %v", err)
@@ -84,6 +227,9 @@ func main() {
 	}
 	log.Printf("Начальный баланс пользователя %d: %s\n", userID, bal.Int) // bal.String() уже человекочитаемый
 
+	if stopRequested() {
+		return
+	}
 	// 6) Пример acquire/release вручную — показываем, что можно брать соединение прямо из пула,
 	// а не всегда через pool.Exec/Query*. Внутри Acquire пул проверит «живость» —
 	// там используется внутренняя логика вида ShouldPing: если пора/нужно — будет Ping,
@@ -92,26 +238,41 @@ func main() {
 		log.Fatalf("sampleAcquireRelease: %v", err)
 	}
 
+	if stopRequested() {
+		return
+	}
 	// 7) Работа с NULL и pgtype.* при сканировании.
 	if err := pgx_demo.DemoScanWithPgtype(rootCtx, pool, email); err != nil {
 		log.Fatalf("demoScanWithPgtype: %v", err)
 	}
 
+	if stopRequested() {
+		return
+	}
 	// 8) Достанем FieldDescriptions() для метаданных запроса — имена и типы колонок результата.
 	if err := pgx_demo.ShowQueryMetadata(rootCtx, pool); err != nil {
 		log.Fatalf("showQueryMetadata: %v", err)
 	}
 
+	if stopRequested() {
+		return
+	}
 	// 9) Метаданные prepared‑выражения без выполнения запроса: ParamOIDs и имена колонок результата.
 	if err := pgx_demo.ShowPreparedStatementMetadata(rootCtx, pool); err != nil {
 		log.Fatalf("prepared metadata: %v", err)
 	}
 
+	if stopRequested() {
+		return
+	}
 	// 10) Пример tx.Query — итерация по Rows внутри транзакции с правильным закрытием/Err/Commit.
 	if err := pgx_demo.TxQueryExample(rootCtx, pool); err != nil {
 		log.Fatalf("tx query example: %v", err)
 	}
 
+	if stopRequested() {
+		return
+	}
 	// 11) Демонстрация записи/чтения ограниченного набора типов с NULL (Valid=false → NULL):
 	// I4 — зададим значение, остальные поля местами оставим NULL с Valid=false.
 	sample := pgx_demo.TypeSample{
@@ -140,10 +301,189 @@ func main() {
 	log.Printf("type_sample id=%d: UUID.Valid=%v I2.Valid=%v I4=%d I8.Valid=%v Flag=%v Note=%s Num.Valid=%v TS.Valid=%v",
 		sid, got.UUID.Valid, got.I2.Valid, got.I4.Int32, got.I8.Valid, got.Flag.Bool, mid, got.Num.Valid, got.TS.Valid)
 
+	if stopRequested() {
+		return
+	}
 	// 12) Обработка ошибок БД: перехват *pgconn.PgError (уникальное нарушение 23505 для email).
 	if err := pgx_demo.DemoPgErrorHandling(rootCtx, pool, email); err != nil {
 		log.Fatalf("pg error handling: %v", err)
 	}
 
+	if stopRequested() {
+		return
+	}
+	// 13) Перевод между счетами: у Alice баланс 0, поэтому ждём типизированную ошибку овердрафта.
+	bobID, err := pgx_demo.UpsertUserAndLogLogin(rootCtx, pool, "bob@example.com", "Bob", nil)
+	if err != nil {
+		log.Fatalf("upsert bob: %v", err)
+	}
+	if err := pgx_demo.EnsureAccount(rootCtx, pool, bobID); err != nil {
+		log.Fatalf("ensureAccount bob: %v", err)
+	}
+	amount := pgtype.Numeric{Int: big.NewInt(1000), Exp: -2, Valid: true} // 10.00
+	var overdraft *pgx_demo.OverdraftError
+	switch err := pgx_demo.Transfer(rootCtx, pool, userID, bobID, amount); {
+	case errors.As(err, &overdraft):
+		log.Printf("Transfer отклонён: %v", overdraft)
+	case err != nil:
+		log.Fatalf("transfer: %v", err)
+	default:
+		log.Printf("Transfer %d -> %d выполнен", userID, bobID)
+	}
+
+	if stopRequested() {
+		return
+	}
+	// 14) Журнал проводок: пополняем счёт Bob «извне», затем сверяем хранимые балансы с суммой журнала.
+	if _, err := pgx_demo.Deposit(rootCtx, pool, bobID, amount, "demo deposit"); err != nil {
+		log.Fatalf("deposit: %v", err)
+	}
+	ledgerBal, err := pgx_demo.RecomputeBalance(rootCtx, pool, bobID)
+	if err != nil {
+		log.Fatalf("recompute balance: %v", err)
+	}
+	drifts, err := pgx_demo.Reconcile(rootCtx, pool)
+	if err != nil {
+		log.Fatalf("reconcile: %v", err)
+	}
+	log.Printf("Ledger: баланс Bob по журналу = %v, счетов с расхождением = %d", ledgerBal.Int, len(drifts))
+
+	if stopRequested() {
+		return
+	}
+	// 15) UserRepository: keyset-пагинация по id и частичное обновление (middle_name из NULL в значение).
+	users := pgx_demo.NewUserRepository(pool)
+	page, next, err := users.List(rootCtx, 0, 2)
+	if err != nil {
+		log.Fatalf("list users: %v", err)
+	}
+	log.Printf("Users: первая страница = %d записей, курсор следующей = %d", len(page), next)
+	updated, err := users.Update(rootCtx, bobID, pgx_demo.UserUpdate{MiddleName: &pgtype.Text{String: "B.", Valid: true}})
+	if err != nil {
+		log.Fatalf("update user: %v", err)
+	}
+	log.Printf("Users: id=%d middle_name=%s", updated.ID, updated.MiddleName.String)
+
+	if stopRequested() {
+		return
+	}
+	// 16) Массовая вставка через COPY: одна команда вместо round-trip на каждую строку.
+	batch := make([]pgx_demo.TypeSample, 100)
+	for i := range batch {
+		batch[i] = pgx_demo.TypeSample{I4: pgtype.Int4{Int32: int32(i), Valid: true}} // прочие поля — NULL
+	}
+	copied, err := pgx_demo.BulkInsertTypeSamples(rootCtx, pool, batch)
+	if err != nil {
+		log.Fatalf("bulk insert: %v", err)
+	}
+	log.Printf("COPY: вставлено строк = %d", copied)
+
+	if stopRequested() {
+		return
+	}
+	// 17) Тот же логин, что в шагах 4–5, но одним round-trip через pgx.Batch.
+	login, err := pgx_demo.LoginBatch(rootCtx, pool, email, name, middleName)
+	if err != nil {
+		var stepErr *pgx_demo.BatchStepError
+		if errors.As(err, &stepErr) {
+			log.Fatalf("login batch: шаг %s: %v", stepErr.Step, stepErr.Err)
+		}
+		log.Fatalf("login batch: %v", err)
+	}
+	log.Printf("LoginBatch: id=%d баланс=%s", login.UserID, login.Balance.Int)
+
+	if stopRequested() {
+		return
+	}
+	// 18) Read/write split: если задан PGREPLICA_URL (можно тот же сервер под другим DSN), читаем баланс с реплики,
+	// а сразу после записи в той же сессии — с primary (read-your-writes).
+	if replicaDSN := os.Getenv("PGREPLICA_URL"); replicaDSN != "" {
+		cluster, err := pgx_demo.NewClusterPool(rootCtx, dsn, []string{replicaDSN}, pgx_demo.ClusterOptions{
+			Balance:              pgx_demo.RoundRobin,
+			ReadYourWritesWindow: 2 * time.Second,
+		})
+		if err != nil {
+			log.Fatalf("cluster pool: %v", err)
+		}
+		sessCtx := cluster.Session(rootCtx)
+		if _, err := pgx_demo.Deposit(sessCtx, cluster.Writer(sessCtx), bobID, amount, "cluster demo"); err != nil {
+			log.Fatalf("cluster deposit: %v", err)
+		}
+		reader := cluster.Reader(sessCtx)
+		bal, err := pgx_demo.GetBalance(sessCtx, reader, bobID)
+		if err != nil {
+			log.Fatalf("cluster balance: %v", err)
+		}
+		log.Printf("Cluster: баланс Bob = %s (чтение с primary: %v)", bal.Int, reader == cluster.Primary())
+		cluster.Close()
+	}
+
+	if stopRequested() {
+		return
+	}
+	// 19) Пулы арендаторов: PGTENANTS=acme,globex — по пулу на арендатора с search_path = tenant_<id>.
+	// Схемы tenant_<id> должны уже содержать таблицы приложения: выражения реестра готовятся в них.
+	if ids := os.Getenv("PGTENANTS"); ids != "" {
+		tenants := pgx_demo.NewTenantPools(dsn, pgx_demo.TenantOptions{Isolation: pgx_demo.TenantSchema, Budget: 20})
+		for _, id := range strings.Split(ids, ",") {
+			tpool, err := tenants.ForTenant(rootCtx, strings.TrimSpace(id))
+			if err != nil {
+				log.Fatalf("tenant %s: %v", id, err)
+			}
+			var schema string
+			if err := tpool.QueryRow(rootCtx, "SELECT current_schema()").Scan(&schema); err != nil {
+				log.Fatalf("tenant %s: %v", id, err)
+			}
+			log.Printf("Tenant %s: current_schema = %s", id, schema)
+		}
+		tenants.Close()
+	}
+
+	if stopRequested() {
+		return
+	}
+	// 20) Приоритетный доступ к пулу: интерактивное чтение баланса не ждёт за фоновыми задачами,
+	// а при перегрузке класс получает ErrPoolSaturated вместо бесконечной очереди.
+	admission := pgx_demo.NewAdmissionPool(pool, pgx_demo.AdmissionOptions{})
+	var prioBal pgtype.Numeric
+	if err := admission.AcquireFunc(rootCtx, pgx_demo.PriorityInteractive, func(c *pgxpool.Conn) error {
+		return c.QueryRow(rootCtx, "ps_get_balance", bobID).Scan(&prioBal) // prepared из AfterConnect
+	}); err != nil {
+		log.Fatalf("admission: %v", err)
+	}
+	log.Printf("Admission: баланс Bob = %s, классы: %+v", prioBal.Int, admission.Stats())
+
+	if stopRequested() {
+		return
+	}
+	// 21) Горячая перезагрузка: PGDSN_FILE — файл с DSN (pool_max_conns, pool_max_conn_lifetime, ...).
+	// Правка файла — новый пул, атомарная подмена и дренаж старого без обрыва начатых транзакций.
+	if path := os.Getenv("PGDSN_FILE"); path != "" {
+		managed, err := pgx_demo.NewManagedPool(rootCtx, pgx_demo.FileSource(path), pgx_demo.ManagedOptions{
+			PoolOptions: poolOpts, // метрики, health policy, breaker, трассировщики — и на каждом новом пуле
+			OnEvent: func(e pgx_demo.ManagedEvent) {
+				log.Printf("managed pool: %s changes=%v drain=%s err=%v", e.Kind, e.Changes, e.Drain, e.Err)
+			},
+		})
+		if err != nil {
+			log.Fatalf("managed pool: %v", err)
+		}
+		go managed.Watch(metricsCtx, 5*time.Second)
+		bal, err := pgx_demo.GetBalance(rootCtx, managed.Pool(), bobID)
+		if err != nil {
+			log.Fatalf("managed pool balance: %v", err)
+		}
+		log.Printf("Managed pool: баланс Bob = %s, MaxConns=%d", bal.Int, managed.Pool().Config().MaxConns)
+		managed.Close()
+	}
+
+	if stopRequested() {
+		return
+	}
+	snap := metrics.Collect(pool)
+	log.Printf("Pool: acquired=%d/%d saturation=%.2f acquire p99=%s",
+		snap.AcquiredConns, snap.MaxConns, snap.Saturation, snap.AcquireWaitP99)
+	log.Printf("Pool: discarded conns by reason: %v", health.Discards())
+
 	log.Println("Демонстрация завершена успешно")
 }
@@ -0,0 +1,330 @@
+// Приоритетный доступ к пулу поверх pool.Acquire.
+// MaxConns — жёсткий потолок, но pgxpool раздаёт соединения в порядке очереди: всплеск фоновых задач
+// может занять все соединения, и чтение баланса (psGetBalance) будет ждать за ними.
+// AdmissionPool делит те же MaxConns слотов между классами:
+//   - у класса есть вес: освободившийся слот достаётся ожидающим классам пропорционально весам
+//     (smooth weighted round-robin), так фоновые задачи не голодают, но и не вытесняют интерактивные;
+//   - потолок одновременных соединений класса (MaxConns);
+//   - ограничение очереди (MaxQueue) и времени ожидания (MaxWait): сверх них — сброс нагрузки
+//     с ошибкой ErrPoolSaturated (детали — *SaturatedError).
+//
+//	ap := NewAdmissionPool(pool, AdmissionOptions{})
+//	conn, err := ap.Acquire(ctx, PriorityInteractive)
+//	if errors.Is(err, ErrPoolSaturated) { /* 503 / повторить позже */ }
+//	defer conn.Release()
+
+package pgx_demo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Priority — класс запроса к пулу.
+type Priority int
+
+const (
+	// PriorityInteractive — запросы пользователя, чувствительные к задержке.
+	PriorityInteractive Priority = iota
+	// PriorityBackground — фоновые задачи, пакетная обработка.
+	PriorityBackground
+	// PriorityMaintenance — обслуживание: миграции данных, сверки, отчёты.
+	PriorityMaintenance
+
+	numPriorities
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityInteractive:
+		return "interactive"
+	case PriorityBackground:
+		return "background"
+	case PriorityMaintenance:
+		return "maintenance"
+	}
+	return fmt.Sprintf("priority(%d)", int(p))
+}
+
+// ErrPoolSaturated — в доступе отказано: очередь класса полна или ожидание вышло за MaxWait.
+var ErrPoolSaturated = errors.New("pool saturated")
+
+// SaturatedError — детали отказа. errors.Is(err, ErrPoolSaturated) == true.
+type SaturatedError struct {
+	Priority Priority
+	Reason   string // "queue_full" или "wait_timeout"
+	Waited   time.Duration
+}
+
+func (e *SaturatedError) Error() string {
+	return fmt.Sprintf("%v: %s %s after %s", ErrPoolSaturated, e.Priority, e.Reason, e.Waited)
+}
+
+func (e *SaturatedError) Unwrap() error { return ErrPoolSaturated }
+
+// ClassLimits — ограничения одного класса.
+type ClassLimits struct {
+	// Weight — доля при раздаче освободившихся слотов. 0 — как 1.
+	Weight int
+	// MaxConns — сколько соединений класс может держать одновременно. 0 — без ограничения (до размера пула).
+	MaxConns int32
+	// MaxQueue — сколько запросов класса может ждать слот. 0 — без ограничения.
+	MaxQueue int
+	// MaxWait — сколько ждать слот; 0 — пока жив ctx.
+	MaxWait time.Duration
+}
+
+// DefaultClassLimits — интерактивные запросы в приоритете, обслуживание — по одному соединению.
+var DefaultClassLimits = map[Priority]ClassLimits{
+	PriorityInteractive: {Weight: 6},
+	PriorityBackground:  {Weight: 3, MaxWait: 5 * time.Second},
+	PriorityMaintenance: {Weight: 1, MaxConns: 1, MaxWait: 30 * time.Second},
+}
+
+// AdmissionOptions — настройки AdmissionPool.
+type AdmissionOptions struct {
+	// Classes — ограничения по классам; отсутствующий класс берётся из DefaultClassLimits.
+	Classes map[Priority]ClassLimits
+	// Slots — сколько соединений раздавать. По умолчанию MaxConns пула.
+	// Меньше MaxConns — запас для кода, который ходит в пул напрямую.
+	Slots int32
+}
+
+// ClassStats — состояние класса.
+type ClassStats struct {
+	Active   int32 // держат слот сейчас
+	Queued   int   // ждут слот
+	Admitted int64 // получили слот всего
+	Shed     int64 // получили ErrPoolSaturated всего
+}
+
+// AdmissionPool — приоритетный Acquire поверх *pgxpool.Pool.
+type AdmissionPool struct {
+	pool  *pgxpool.Pool
+	slots int32
+
+	mu      sync.Mutex
+	inUse   int32
+	classes [numPriorities]admissionClass
+
+	now func() time.Time
+}
+
+type admissionClass struct {
+	limits  ClassLimits
+	active  int32
+	queue   []*admissionWaiter
+	current int // счётчик smooth weighted round-robin
+
+	admitted, shed int64
+}
+
+type admissionWaiter struct {
+	ready   chan struct{} // закрывается при выдаче слота
+	granted bool
+}
+
+// NewAdmissionPool — приоритетный доступ к pool.
+func NewAdmissionPool(pool *pgxpool.Pool, opts AdmissionOptions) *AdmissionPool {
+	slots := opts.Slots
+	if slots <= 0 {
+		slots = pool.Config().MaxConns
+	}
+	return newAdmissionPool(pool, slots, opts.Classes)
+}
+
+func newAdmissionPool(pool *pgxpool.Pool, slots int32, classes map[Priority]ClassLimits) *AdmissionPool {
+	ap := &AdmissionPool{pool: pool, slots: slots, now: time.Now}
+	for p := range ap.classes {
+		l, ok := classes[Priority(p)]
+		if !ok {
+			l = DefaultClassLimits[Priority(p)]
+		}
+		if l.Weight <= 0 {
+			l.Weight = 1
+		}
+		ap.classes[p].limits = l
+	}
+	return ap
+}
+
+// AdmittedConn — соединение, выданное через AdmissionPool. Release возвращает и соединение, и слот.
+type AdmittedConn struct {
+	*pgxpool.Conn
+	release func()
+}
+
+// Release — вернуть соединение в пул и слот классу. Повторный вызов ничего не делает.
+func (c *AdmittedConn) Release() {
+	if c.release == nil {
+		return
+	}
+	c.Conn.Release()
+	c.release()
+	c.release = nil
+}
+
+// Acquire — соединение для класса prio: ждёт слот по правилам класса, затем pool.Acquire.
+func (ap *AdmissionPool) Acquire(ctx context.Context, prio Priority) (*AdmittedConn, error) {
+	release, err := ap.admit(ctx, prio)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := ap.pool.Acquire(ctx)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &AdmittedConn{Conn: conn, release: release}, nil
+}
+
+// AcquireFunc — как pgxpool.Pool.AcquireFunc, но с приоритетом.
+func (ap *AdmissionPool) AcquireFunc(ctx context.Context, prio Priority, fn func(*pgxpool.Conn) error) error {
+	conn, err := ap.Acquire(ctx, prio)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	return fn(conn.Conn)
+}
+
+// Stats — состояние классов.
+func (ap *AdmissionPool) Stats() map[Priority]ClassStats {
+	ap.mu.Lock()
+	defer ap.mu.Unlock()
+	out := make(map[Priority]ClassStats, numPriorities)
+	for p := range ap.classes {
+		c := &ap.classes[p]
+		out[Priority(p)] = ClassStats{Active: c.active, Queued: len(c.queue), Admitted: c.admitted, Shed: c.shed}
+	}
+	return out
+}
+
+// admit — занять слот класса prio; release возвращает его.
+func (ap *AdmissionPool) admit(ctx context.Context, prio Priority) (release func(), err error) {
+	if prio < 0 || prio >= numPriorities {
+		return nil, fmt.Errorf("admission: unknown priority %d", int(prio))
+	}
+	release = func() { ap.release(prio) }
+
+	ap.mu.Lock()
+	c := &ap.classes[prio]
+	// dispatch раздаёт слоты сразу при освобождении, поэтому свободный слот означает,
+	// что ждут только классы, упёршиеся в свой MaxConns, — очередь и веса не обходим.
+	if ap.inUse < ap.slots && c.underCap() {
+		ap.grant(c)
+		ap.mu.Unlock()
+		return release, nil
+	}
+	if c.limits.MaxQueue > 0 && len(c.queue) >= c.limits.MaxQueue {
+		c.shed++
+		ap.mu.Unlock()
+		return nil, &SaturatedError{Priority: prio, Reason: "queue_full"}
+	}
+	w := &admissionWaiter{ready: make(chan struct{})}
+	c.queue = append(c.queue, w)
+	ap.mu.Unlock()
+
+	start := ap.now()
+	var timeout <-chan time.Time
+	if c.limits.MaxWait > 0 {
+		t := time.NewTimer(c.limits.MaxWait)
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case <-w.ready:
+		return release, nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timeout:
+		err = &SaturatedError{Priority: prio, Reason: "wait_timeout", Waited: ap.now().Sub(start)}
+	}
+
+	ap.mu.Lock()
+	defer ap.mu.Unlock()
+	if w.granted {
+		// Слот выдали одновременно с отменой — отдаём его следующему.
+		ap.releaseLocked(prio)
+	} else {
+		c.remove(w)
+	}
+	if errors.Is(err, ErrPoolSaturated) {
+		c.shed++
+	}
+	return nil, err
+}
+
+func (ap *AdmissionPool) release(prio Priority) {
+	ap.mu.Lock()
+	defer ap.mu.Unlock()
+	ap.releaseLocked(prio)
+}
+
+func (ap *AdmissionPool) releaseLocked(prio Priority) {
+	ap.inUse--
+	ap.classes[prio].active--
+	ap.dispatch()
+}
+
+// dispatch — раздать свободные слоты ожидающим по весам. Вызывается под ap.mu.
+func (ap *AdmissionPool) dispatch() {
+	for ap.inUse < ap.slots {
+		c := ap.next()
+		if c == nil {
+			return
+		}
+		w := c.queue[0]
+		c.queue = c.queue[1:]
+		w.granted = true
+		ap.grant(c)
+		close(w.ready)
+	}
+}
+
+// next — smooth weighted round-robin среди классов, у которых есть очередь и не исчерпан MaxConns.
+func (ap *AdmissionPool) next() *admissionClass {
+	var (
+		best  *admissionClass
+		total int
+	)
+	for p := range ap.classes {
+		c := &ap.classes[p]
+		if len(c.queue) == 0 || !c.underCap() {
+			continue
+		}
+		c.current += c.limits.Weight
+		total += c.limits.Weight
+		if best == nil || c.current > best.current {
+			best = c
+		}
+	}
+	if best != nil {
+		best.current -= total
+	}
+	return best
+}
+
+func (ap *AdmissionPool) grant(c *admissionClass) {
+	ap.inUse++
+	c.active++
+	c.admitted++
+}
+
+func (c *admissionClass) underCap() bool {
+	return c.limits.MaxConns <= 0 || c.active < c.limits.MaxConns
+}
+
+func (c *admissionClass) remove(w *admissionWaiter) {
+	for i, q := range c.queue {
+		if q == w {
+			c.queue = append(c.queue[:i], c.queue[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package pgx_demo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitQueued — ждём, пока в очереди класса появится n ожидающих.
+func waitQueued(t *testing.T, ap *AdmissionPool, prio Priority, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for ap.Stats()[prio].Queued != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s: queued = %d, want %d", prio, ap.Stats()[prio].Queued, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestAdmissionImmediateAndCaps(t *testing.T) {
+	ap := newAdmissionPool(nil, 3, map[Priority]ClassLimits{
+		PriorityMaintenance: {MaxConns: 1, MaxQueue: 1},
+	})
+	ctx := context.Background()
+
+	rel1, err := ap.admit(ctx, PriorityMaintenance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Второй maintenance упирается в MaxConns и встаёт в очередь, третий — сброс нагрузки.
+	got := make(chan error, 1)
+	go func() {
+		rel, err := ap.admit(ctx, PriorityMaintenance)
+		if err == nil {
+			rel()
+		}
+		got <- err
+	}()
+	waitQueued(t, ap, PriorityMaintenance, 1)
+	_, err = ap.admit(ctx, PriorityMaintenance)
+	var se *SaturatedError
+	if !errors.Is(err, ErrPoolSaturated) || !errors.As(err, &se) || se.Reason != "queue_full" || se.Priority != PriorityMaintenance {
+		t.Fatalf("err = %v, want queue_full", err)
+	}
+
+	// Ожидающий maintenance не мешает другим классам занять свободные слоты.
+	relI, err := ap.admit(ctx, PriorityInteractive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	relI()
+
+	rel1()
+	if err := <-got; err != nil {
+		t.Fatalf("queued maintenance: %v", err)
+	}
+	st := ap.Stats()[PriorityMaintenance]
+	if st.Active != 0 || st.Queued != 0 || st.Admitted != 2 || st.Shed != 1 {
+		t.Errorf("maintenance stats = %+v", st)
+	}
+	if ap.inUse != 0 {
+		t.Errorf("inUse = %d after all releases", ap.inUse)
+	}
+}
+
+func TestAdmissionWeightedDispatch(t *testing.T) {
+	ap := newAdmissionPool(nil, 1, map[Priority]ClassLimits{
+		PriorityInteractive: {Weight: 3},
+		PriorityBackground:  {Weight: 1},
+	})
+	ctx := context.Background()
+	hold, _ := ap.admit(ctx, PriorityBackground)
+
+	// По 4 ожидающих в каждом классе; слот один — порядок выдачи задают веса.
+	order := make(chan Priority, 8)
+	for _, prio := range []Priority{PriorityInteractive, PriorityBackground} {
+		for i := 0; i < 4; i++ {
+			go func() {
+				rel, err := ap.admit(ctx, prio)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				order <- prio
+				rel()
+			}()
+		}
+		waitQueued(t, ap, prio, 4)
+	}
+	hold()
+
+	var first4 [numPriorities]int
+	for i := 0; i < 8; i++ {
+		p := <-order
+		if i < 4 {
+			first4[p]++
+		}
+	}
+	if first4[PriorityInteractive] != 3 || first4[PriorityBackground] != 1 {
+		t.Errorf("first 4 grants = %v, want 3 interactive : 1 background", first4)
+	}
+}
+
+func TestAdmissionWaitTimeoutAndCancel(t *testing.T) {
+	ap := newAdmissionPool(nil, 1, map[Priority]ClassLimits{
+		PriorityBackground: {MaxWait: 10 * time.Millisecond},
+	})
+	hold, _ := ap.admit(context.Background(), PriorityInteractive)
+	defer hold()
+
+	_, err := ap.admit(context.Background(), PriorityBackground)
+	var se *SaturatedError
+	if !errors.As(err, &se) || se.Reason != "wait_timeout" || se.Waited <= 0 {
+		t.Fatalf("err = %v, want wait_timeout", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := ap.admit(ctx, PriorityInteractive); !errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrPoolSaturated) {
+		t.Fatalf("err = %v, want context deadline", err)
+	}
+	st := ap.Stats()
+	if st[PriorityBackground].Shed != 1 || st[PriorityInteractive].Shed != 0 || st[PriorityInteractive].Queued != 0 {
+		t.Errorf("stats = %+v", st)
+	}
+	if _, err := ap.admit(context.Background(), Priority(7)); err == nil {
+		t.Error("unknown priority accepted")
+	}
+}
@@ -0,0 +1,120 @@
+// Логин одним round-trip: upsert пользователя, last_login, создание счёта и чтение баланса
+// ставятся в один pgx.Batch и уходят на сервер одним пакетом.
+// Без явной транзакции батч выполняется в неявной транзакции (один Sync в конце):
+// шаги видят изменения друг друга, а ошибка любого шага откатывает все.
+
+package pgx_demo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/MrTeeett/pgx-v5-pool-examples/pgx_demo/pgerr"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Шаги батча не могут передать друг другу id из RETURNING, поэтому адресуем пользователя по email
+// (уникальный ключ) — строка, вставленная первым шагом, уже видна в той же неявной транзакции.
+var (
+	psSetLastLoginByEmail = Statements.MustRegister("ps_set_last_login_by_email",
+		`UPDATE app_users SET last_login = now() WHERE email = $1`)
+	psEnsureAccountByEmail = Statements.MustRegister("ps_ensure_account_by_email",
+		`INSERT INTO accounts(user_id, balance)
+		 SELECT id, 0 FROM app_users WHERE email = $1
+		 ON CONFLICT (user_id) DO NOTHING`)
+	psGetBalanceByEmail = Statements.MustRegister("ps_get_balance_by_email",
+		`SELECT a.balance
+		   FROM accounts a
+		   JOIN app_users u ON u.id = a.user_id
+		  WHERE u.email = $1`)
+)
+
+// Имена шагов LoginBatch — в порядке постановки в батч.
+const (
+	StepUpsertUser    = "upsert_user"
+	StepSetLastLogin  = "set_last_login"
+	StepEnsureAccount = "ensure_account"
+	StepGetBalance    = "get_balance"
+)
+
+// ErrBatchAborted — шаг не выполнялся: раньше в том же батче упал другой шаг.
+var ErrBatchAborted = errors.New("batch aborted by an earlier step")
+
+// BatchStepError — ошибка конкретного шага батча.
+// errors.As(err, &stepErr) отдаёт первый (реально упавший) шаг; errors.Is видит и pgerr-класс его ошибки.
+type BatchStepError struct {
+	Index int
+	Step  string
+	Err   error
+}
+
+func (e *BatchStepError) Error() string {
+	return fmt.Sprintf("batch step %d (%s): %v", e.Index, e.Step, e.Err)
+}
+
+func (e *BatchStepError) Unwrap() error { return e.Err }
+
+// LoginResult — итог LoginBatch.
+type LoginResult struct {
+	UserID  int64
+	Balance pgtype.Numeric
+}
+
+// LoginBatch — то же, что UpsertUserAndLogLogin + EnsureAccount + GetBalance, но за один round-trip.
+// Ошибка — errors.Join из *BatchStepError по каждому невыполненному шагу: упавший шаг несёт
+// классифицированную ошибку БД, последующие — ErrBatchAborted.
+// Повторов нет: при конфликте сериализации/обрыве вызывающий может просто повторить вызов целиком.
+func LoginBatch(ctx context.Context, pool *pgxpool.Pool, email, name string, middleName *string) (LoginResult, error) {
+	var mid pgtype.Text
+	if middleName != nil {
+		mid = pgtype.Text{String: *middleName, Valid: true}
+	}
+
+	b := &pgx.Batch{}
+	b.Queue(psInsertUser.Name(), email, name, mid)
+	b.Queue(psSetLastLoginByEmail.Name(), email)
+	b.Queue(psEnsureAccountByEmail.Name(), email)
+	b.Queue(psGetBalanceByEmail.Name(), email)
+	br := pool.SendBatch(ctx, b)
+
+	var res LoginResult
+	err := runBatchSteps([]batchStep{
+		{StepUpsertUser, func() error { return br.QueryRow().Scan(&res.UserID) }},
+		{StepSetLastLogin, func() error { _, err := br.Exec(); return err }},
+		{StepEnsureAccount, func() error { _, err := br.Exec(); return err }},
+		{StepGetBalance, func() error { return br.QueryRow().Scan(&res.Balance) }},
+	})
+	// Close обязателен: он вычитывает остаток ответа и возвращает соединение в пул.
+	if closeErr := br.Close(); err == nil && closeErr != nil {
+		return LoginResult{}, pgerr.Classify(closeErr)
+	}
+	if err != nil {
+		return LoginResult{}, err
+	}
+	return res, nil
+}
+
+// batchStep — чтение результата одного элемента батча.
+type batchStep struct {
+	name string
+	read func() error
+}
+
+// runBatchSteps читает результаты по порядку. После первой ошибки остальные шаги не читаются
+// (pgx вернул бы для них ту же ошибку) и помечаются ErrBatchAborted.
+func runBatchSteps(steps []batchStep) error {
+	var errs []error
+	for i, s := range steps {
+		if len(errs) > 0 {
+			errs = append(errs, &BatchStepError{Index: i, Step: s.name, Err: ErrBatchAborted})
+			continue
+		}
+		if err := s.read(); err != nil {
+			errs = append(errs, &BatchStepError{Index: i, Step: s.name, Err: pgerr.Classify(err)})
+		}
+	}
+	return errors.Join(errs...)
+}
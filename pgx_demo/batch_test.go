@@ -0,0 +1,45 @@
+package pgx_demo
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/MrTeeett/pgx-v5-pool-examples/pgx_demo/pgerr"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestRunBatchSteps(t *testing.T) {
+	var read []string
+	step := func(name string, err error) batchStep {
+		return batchStep{name, func() error { read = append(read, name); return err }}
+	}
+
+	if err := runBatchSteps([]batchStep{step("a", nil), step("b", nil)}); err != nil || len(read) != 2 {
+		t.Fatalf("err=%v read=%v, want both steps ok", err, read)
+	}
+
+	read = nil
+	err := runBatchSteps([]batchStep{
+		step("a", nil),
+		step("b", &pgconn.PgError{Code: pgerr.CodeUniqueViolation}),
+		step("c", nil),
+	})
+	if len(read) != 2 {
+		t.Fatalf("read = %v, want reading to stop after the failed step", read)
+	}
+	var se *BatchStepError
+	if !errors.As(err, &se) || se.Index != 1 || se.Step != "b" {
+		t.Fatalf("first step error = %+v, want index 1 (b)", se)
+	}
+	if !errors.Is(err, pgerr.ErrUniqueViolation) || !errors.Is(err, ErrBatchAborted) {
+		t.Errorf("err = %v, want both the classified failure and ErrBatchAborted", err)
+	}
+}
+
+func TestLoginBatchStatementsRegistered(t *testing.T) {
+	for _, name := range []string{"ps_set_last_login_by_email", "ps_ensure_account_by_email", "ps_get_balance_by_email"} {
+		if _, ok := Statements.Lookup(name); !ok {
+			t.Errorf("statement %s is not registered", name)
+		}
+	}
+}
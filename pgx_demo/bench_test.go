@@ -1,7 +1,9 @@
 // bench_test.go
 // Небольшие бенчмарки:
 // 1) acquire/release — базовая издержка выдачи соединения,
-// 2) minimal prepared select — сравнение «без prepare» и «с prepare».
+// 2) minimal prepared select — сравнение «без prepare» и «с prepare»,
+// 3) вставка пачки type_samples — COPY vs SendBatch vs prepared по одной строке,
+// 4) логин — последовательные вызовы из main.go vs один батч (LoginBatch).
 // Запускайте: go test -bench=. -benchmem
 
 package pgx_demo
@@ -12,6 +14,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -78,9 +82,91 @@ func BenchmarkMinimalPreparedSelect(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		var id int64
-		err := pool.QueryRow(ctx, psGetUserIdByEmail, "bench@example.com").Scan(&id)
+		err := psGetUserIdByEmail.QueryRow(ctx, pool, "bench@example.com").Scan(&id)
 		if err != nil {
 			b.Fatal(err)
 		}
 	}
 }
+
+// benchTypeSamples — пачка строк для сравнения способов вставки.
+func benchTypeSamples(n int) []TypeSample {
+	out := make([]TypeSample, n)
+	for i := range out {
+		out[i] = TypeSample{
+			I4:   pgtype.Int4{Int32: int32(i), Valid: true},
+			I8:   pgtype.Int8{Int64: int64(i) * 1000, Valid: true},
+			Flag: pgtype.Bool{Bool: i%2 == 0, Valid: true},
+			Note: pgtype.Text{String: "bench", Valid: true},
+			TS:   pgtype.Timestamp{Time: time.Now(), Valid: true},
+		}
+	}
+	return out
+}
+
+// BenchmarkInsertTypeSamples — одна итерация = вставка 1000 строк.
+func BenchmarkInsertTypeSamples(b *testing.B) {
+	pool := benchPool(b)
+	ctx := context.Background()
+	samples := benchTypeSamples(1000)
+	b.Cleanup(func() { _, _ = pool.Exec(context.Background(), `DELETE FROM type_samples WHERE note = 'bench'`) })
+
+	b.Run("CopyFrom", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := BulkInsertTypeSamples(ctx, pool, samples); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("SendBatch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			batch := &pgx.Batch{}
+			for _, s := range samples {
+				batch.Queue(psInsertTypeSample.Name(), s.UUID, s.I2, s.I4, s.I8, s.Flag, s.Note, s.Num, s.TS)
+			}
+			if err := pool.SendBatch(ctx, batch).Close(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("PreparedSingleRow", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, s := range samples {
+				if _, err := InsertTypeSample(ctx, pool, s); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
+
+func BenchmarkLogin(b *testing.B) {
+	pool := benchPool(b)
+	ctx := context.Background()
+
+	// Текущая последовательность из main.go: транзакция (BEGIN, 2 выражения, COMMIT) + 2 запроса.
+	b.Run("Sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			id, err := UpsertUserAndLogLogin(ctx, pool, "bench@example.com", "Bench", nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if err := EnsureAccount(ctx, pool, id); err != nil {
+				b.Fatal(err)
+			}
+			if _, err := GetBalance(ctx, pool, id); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Batch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := LoginBatch(ctx, pool, "bench@example.com", "Bench", nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
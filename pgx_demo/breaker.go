@@ -0,0 +1,305 @@
+// Circuit breaker для пула: когда Postgres лежит, каждый вызов (UpsertUserAndLogLogin, GetBalance, ...)
+// иначе ждёт свой connect_timeout. Breaker считает подряд идущие ошибки соединения и после
+// FailureThreshold «размыкается»: новые подключения пула отклоняются в BeforeConnect сразу,
+// с ошибкой ErrCircuitOpen (детали — *CircuitOpenError).
+//
+// Состояния:
+//   - closed — всё пропускаем, считаем ошибки подряд; любой успех сбрасывает счётчик;
+//   - open — подключения отклоняются; через OpenTimeout Run переводит breaker в half-open;
+//   - half-open — Run проверяет базу одним pool.Ping (подключаться разрешено только ему):
+//     успех — closed, ошибка — снова open.
+//
+// Подключение:
+//
+//	b := NewCircuitBreaker(BreakerOptions{OnStateChange: func(from, to BreakerState) { ... }})
+//	pool, _ := BuildPool(ctx, dsn, WithCircuitBreaker(b))
+//	go b.Run(ctx, pool)
+
+package pgx_demo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/MrTeeett/pgx-v5-pool-examples/pgx_demo/pgerr"
+	"github.com/jackc/pgx/v5"
+)
+
+// BreakerState — состояние circuit breaker.
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half_open"
+	}
+	return fmt.Sprintf("breaker_state(%d)", int(s))
+}
+
+// ErrCircuitOpen — breaker разомкнут, к базе не обращаемся.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// CircuitOpenError — детали отказа. errors.Is(err, ErrCircuitOpen) == true.
+type CircuitOpenError struct {
+	State   BreakerState
+	RetryAt time.Time // когда будет следующая проверка базы
+	LastErr error     // ошибка, разомкнувшая breaker
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%v (%s, retry at %s): %v", ErrCircuitOpen, e.State, e.RetryAt.Format(time.RFC3339), e.LastErr)
+}
+
+func (e *CircuitOpenError) Unwrap() error { return ErrCircuitOpen }
+
+// BreakerOptions — настройки CircuitBreaker.
+type BreakerOptions struct {
+	// FailureThreshold — сколько ошибок соединения подряд размыкают breaker. По умолчанию 5.
+	FailureThreshold int
+	// OpenTimeout — сколько оставаться open перед проверкой. По умолчанию 5s.
+	OpenTimeout time.Duration
+	// ProbeTimeout — таймаут проверочного pool.Ping. По умолчанию 2s.
+	ProbeTimeout time.Duration
+	// OnStateChange — вызывается при каждой смене состояния (синхронно, вне блокировок breaker).
+	OnStateChange func(from, to BreakerState)
+}
+
+const (
+	defaultBreakerFailures     = 5
+	defaultBreakerOpenTimeout  = 5 * time.Second
+	defaultBreakerProbeTimeout = 2 * time.Second
+)
+
+// BreakerStats — состояние и счётчики для метрик.
+type BreakerStats struct {
+	State               BreakerState
+	ConsecutiveFailures int
+	Trips               int64 // сколько раз размыкался
+	Rejected            int64 // сколько подключений/вызовов отклонено
+}
+
+// CircuitBreaker — breaker одного пула. Подключается через WithCircuitBreaker, проверку ведёт Run.
+type CircuitBreaker struct {
+	opts BreakerOptions
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	lastErr  error
+	trips    int64
+	rejected int64
+
+	now func() time.Time
+}
+
+// NewCircuitBreaker — breaker в состоянии closed.
+func NewCircuitBreaker(opts BreakerOptions) *CircuitBreaker {
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = defaultBreakerFailures
+	}
+	if opts.OpenTimeout <= 0 {
+		opts.OpenTimeout = defaultBreakerOpenTimeout
+	}
+	if opts.ProbeTimeout <= 0 {
+		opts.ProbeTimeout = defaultBreakerProbeTimeout
+	}
+	return &CircuitBreaker{opts: opts, now: time.Now}
+}
+
+// WithCircuitBreaker — подключить breaker к пулу: BeforeConnect отклоняет подключения, пока breaker
+// не closed, а трассировщик сообщает ему об ошибках подключения и запросов.
+func WithCircuitBreaker(b *CircuitBreaker) PoolOption {
+	return func(o *poolOptions) {
+		o.hooks = append(o.hooks, Hooks{BeforeConnect: func(ctx context.Context, _ *pgx.ConnConfig) error {
+			return b.allowConnect(ctx)
+		}})
+		o.queryTracers = append(o.queryTracers, b)
+	}
+}
+
+// State — текущее состояние.
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Stats — состояние и счётчики.
+func (b *CircuitBreaker) Stats() BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return BreakerStats{State: b.state, ConsecutiveFailures: b.failures, Trips: b.trips, Rejected: b.rejected}
+}
+
+// Allow — быстрая проверка перед обращением к базе: nil, если breaker closed, иначе *CircuitOpenError.
+// Так вызывающий код отказывает сразу, даже не доходя до pool.Acquire.
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerClosed {
+		return nil
+	}
+	return b.rejectLocked()
+}
+
+type breakerProbeKey struct{}
+
+// allowConnect — BeforeConnect: в half-open подключается только проверка из Run.
+func (b *CircuitBreaker) allowConnect(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case b.state == BreakerClosed:
+		return nil
+	case b.state == BreakerHalfOpen && ctx.Value(breakerProbeKey{}) != nil:
+		return nil
+	}
+	return b.rejectLocked()
+}
+
+func (b *CircuitBreaker) rejectLocked() error {
+	b.rejected++
+	return &CircuitOpenError{State: b.state, RetryAt: b.openedAt.Add(b.opts.OpenTimeout), LastErr: b.lastErr}
+}
+
+// Success — база ответила: счётчик ошибок сбрасывается, open/half-open замыкается.
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	b.failures = 0
+	from, changed := b.setLocked(BreakerClosed)
+	b.mu.Unlock()
+	b.notify(from, BreakerClosed, changed)
+}
+
+// Failure — ошибка соединения: в closed копим до FailureThreshold, в half-open размыкаемся сразу.
+func (b *CircuitBreaker) Failure(err error) {
+	b.mu.Lock()
+	b.failures++
+	b.lastErr = err
+	var (
+		from    BreakerState
+		changed bool
+	)
+	if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.failures >= b.opts.FailureThreshold) {
+		from, changed = b.setLocked(BreakerOpen)
+	}
+	b.mu.Unlock()
+	b.notify(from, BreakerOpen, changed)
+}
+
+// setLocked — сменить состояние; changed=false, если оно уже такое.
+func (b *CircuitBreaker) setLocked(to BreakerState) (from BreakerState, changed bool) {
+	from = b.state
+	if from == to {
+		return from, false
+	}
+	b.state = to
+	if to == BreakerOpen {
+		b.openedAt = b.now()
+		b.trips++
+	}
+	return from, true
+}
+
+func (b *CircuitBreaker) notify(from, to BreakerState, changed bool) {
+	if changed && b.opts.OnStateChange != nil {
+		b.opts.OnStateChange(from, to)
+	}
+}
+
+// Run — проверка базы, пока не отменён ctx: разомкнутый дольше OpenTimeout breaker переходит
+// в half-open и делает pool.Ping. Без Run breaker, однажды разомкнувшись, так и останется open.
+func (b *CircuitBreaker) Run(ctx context.Context, pool Pinger) {
+	t := time.NewTicker(max(b.opts.OpenTimeout/4, time.Millisecond))
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			b.probe(ctx, pool)
+		}
+	}
+}
+
+// Pinger — то, что нужно Run от пула (*pgxpool.Pool).
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// probe — одна проверка, если пора.
+func (b *CircuitBreaker) probe(ctx context.Context, pool Pinger) {
+	b.mu.Lock()
+	if b.state != BreakerOpen || b.now().Sub(b.openedAt) < b.opts.OpenTimeout {
+		b.mu.Unlock()
+		return
+	}
+	from, changed := b.setLocked(BreakerHalfOpen)
+	b.mu.Unlock()
+	b.notify(from, BreakerHalfOpen, changed)
+
+	ctx, cancel := context.WithTimeout(context.WithValue(ctx, breakerProbeKey{}, true), b.opts.ProbeTimeout)
+	defer cancel()
+	if err := pool.Ping(ctx); err != nil {
+		b.Failure(err)
+		return
+	}
+	b.Success()
+}
+
+// isBreakerFailure — ошибка, говорящая о недоступности базы, а не о конкретном запросе.
+func isBreakerFailure(err error) bool {
+	if errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+	kind := pgerr.Classify(err)
+	return errors.Is(kind, pgerr.ErrConnLost) || errors.Is(kind, pgerr.ErrUnavailable)
+}
+
+// observe — исход обращения к базе: nil и «обычные» ошибки запроса считаются успехом связи.
+func (b *CircuitBreaker) observe(err error) {
+	if isBreakerFailure(err) {
+		b.Failure(err)
+		return
+	}
+	if errors.Is(pgerr.Classify(err), pgerr.ErrQueryCanceled) {
+		return // отмена вызывающим ничего не говорит о базе
+	}
+	b.Success()
+}
+
+// TraceConnectStart/TraceConnectEnd — исход каждого подключения пула.
+func (b *CircuitBreaker) TraceConnectStart(ctx context.Context, _ pgx.TraceConnectStartData) context.Context {
+	return ctx
+}
+
+func (b *CircuitBreaker) TraceConnectEnd(_ context.Context, data pgx.TraceConnectEndData) {
+	if data.Err != nil {
+		b.Failure(data.Err)
+		return
+	}
+	b.observe(nil)
+}
+
+// TraceQueryStart/TraceQueryEnd — обрыв соединения посреди запроса тоже считается ошибкой.
+func (b *CircuitBreaker) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	return ctx
+}
+
+func (b *CircuitBreaker) TraceQueryEnd(_ context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	b.observe(data.Err)
+}
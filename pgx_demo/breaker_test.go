@@ -0,0 +1,157 @@
+package pgx_demo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// breakerHarness — breaker с ручными часами и записью переходов.
+func breakerHarness(opts BreakerOptions) (*CircuitBreaker, *[]string, *time.Time) {
+	var transitions []string
+	opts.OnStateChange = func(from, to BreakerState) { transitions = append(transitions, from.String()+"->"+to.String()) }
+	b := NewCircuitBreaker(opts)
+	now := time.Unix(1000, 0)
+	b.now = func() time.Time { return now }
+	return b, &transitions, &now
+}
+
+type pingerFunc func(context.Context) error
+
+func (f pingerFunc) Ping(ctx context.Context) error { return f(ctx) }
+
+func TestCircuitBreakerTripsAndRecovers(t *testing.T) {
+	b, transitions, now := breakerHarness(BreakerOptions{FailureThreshold: 3, OpenTimeout: 10 * time.Second})
+	ctx := context.Background()
+
+	// Успех между ошибками сбрасывает счётчик.
+	b.Failure(io.EOF)
+	b.Failure(io.EOF)
+	b.observe(nil)
+	b.Failure(io.EOF)
+	b.Failure(io.EOF)
+	if b.State() != BreakerClosed {
+		t.Fatal("breaker opened without 3 consecutive failures")
+	}
+	b.Failure(io.EOF)
+	if b.State() != BreakerOpen {
+		t.Fatal("breaker did not open after 3 consecutive failures")
+	}
+
+	err := b.allowConnect(ctx)
+	var oe *CircuitOpenError
+	if !errors.Is(err, ErrCircuitOpen) || !errors.As(err, &oe) || oe.LastErr != io.EOF || !oe.RetryAt.Equal(now.Add(10*time.Second)) {
+		t.Fatalf("allowConnect = %v", err)
+	}
+	if b.Allow() == nil {
+		t.Error("Allow must fail fast while open")
+	}
+
+	// Рано — проверки нет.
+	pings := 0
+	failing := pingerFunc(func(ctx context.Context) error {
+		pings++
+		if ctx.Value(breakerProbeKey{}) == nil {
+			t.Error("probe ctx is not marked")
+		}
+		if err := b.allowConnect(ctx); err != nil {
+			t.Errorf("probe connect rejected: %v", err)
+		}
+		if err := b.allowConnect(context.Background()); err == nil {
+			t.Error("half-open must reject connects other than the probe")
+		}
+		return io.ErrUnexpectedEOF
+	})
+	b.probe(ctx, failing)
+	if pings != 0 {
+		t.Fatal("probe before OpenTimeout")
+	}
+
+	// Неудачная проверка — снова open с новым отсчётом.
+	*now = now.Add(10 * time.Second)
+	b.probe(ctx, failing)
+	if pings != 1 || b.State() != BreakerOpen {
+		t.Fatalf("pings=%d state=%s, want reopened", pings, b.State())
+	}
+	b.probe(ctx, failing)
+	if pings != 1 {
+		t.Fatal("reopened breaker must wait OpenTimeout again")
+	}
+
+	*now = now.Add(10 * time.Second)
+	b.probe(ctx, pingerFunc(func(context.Context) error { return nil }))
+	if b.State() != BreakerClosed || b.Allow() != nil {
+		t.Fatalf("state = %s after successful probe", b.State())
+	}
+
+	want := "closed->open open->half_open half_open->open open->half_open half_open->closed"
+	if got := strings.Join(*transitions, " "); got != want {
+		t.Errorf("transitions = %s\nwant %s", got, want)
+	}
+	st := b.Stats()
+	if st.Trips != 2 || st.Rejected < 3 || st.ConsecutiveFailures != 0 {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+func TestCircuitBreakerObserve(t *testing.T) {
+	b, _, _ := breakerHarness(BreakerOptions{FailureThreshold: 1})
+	// Ошибки запроса и отмена не размыкают breaker.
+	for _, err := range []error{
+		&pgconn.PgError{Code: "23505"},
+		context.Canceled,
+		errors.New("boom"),
+		&CircuitOpenError{},
+	} {
+		b.TraceQueryEnd(context.Background(), nil, pgx.TraceQueryEndData{Err: err})
+		if b.State() != BreakerClosed {
+			t.Fatalf("%v opened the breaker", err)
+		}
+	}
+	b.TraceQueryEnd(context.Background(), nil, pgx.TraceQueryEndData{Err: &pgconn.PgError{Code: "57P01"}})
+	if b.State() != BreakerOpen {
+		t.Fatal("admin_shutdown must open the breaker")
+	}
+	b.TraceConnectEnd(context.Background(), pgx.TraceConnectEndData{})
+	if b.State() != BreakerClosed {
+		t.Fatal("successful connect must close the breaker")
+	}
+	b.TraceConnectEnd(context.Background(), pgx.TraceConnectEndData{Err: errors.New("dial tcp: connection refused")})
+	if b.State() != BreakerOpen {
+		t.Fatal("failed connect must count as failure")
+	}
+}
+
+func TestWithCircuitBreakerFailsFast(t *testing.T) {
+	b := NewCircuitBreaker(BreakerOptions{FailureThreshold: 1})
+	pool, err := BuildPool(context.Background(), testDSN, WithMinConns(0), WithMinIdleConns(0), WithCircuitBreaker(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	b.Failure(io.EOF)
+
+	start := time.Now()
+	err = pool.Ping(context.Background())
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Ping = %v, want ErrCircuitOpen", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("open breaker took %s to fail", d)
+	}
+
+	m := NewPoolMetrics("main")
+	m.TrackBreaker(b)
+	var buf bytes.Buffer
+	m.WriteTo(&buf)
+	if !strings.Contains(buf.String(), `pgxpool_breaker_state{pool="main"} 1`) || !strings.Contains(buf.String(), `pgxpool_breaker_trips_total{pool="main"} 1`) {
+		t.Errorf("breaker metrics missing:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,52 @@
+// Массовая загрузка type_samples через COPY FROM STDIN.
+// InsertTypeSample — один round-trip на строку; COPY отправляет все строки одним потоком
+// в бинарном формате, без разбора SQL на каждую строку.
+
+package pgx_demo
+
+import (
+	"context"
+
+	"github.com/MrTeeett/pgx-v5-pool-examples/pgx_demo/pgerr"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// typeSampleColumns — колонки COPY в порядке значений из typeSampleSource.Values.
+var typeSampleColumns = []string{"uid", "i2", "i4", "i8", "flag", "note", "num", "ts"}
+
+// BulkInsertTypeSamples — вставка пачки строк одним COPY. Возвращает число вставленных строк.
+// COPY атомарен: при ошибке (нарушение ограничения, обрыв) не вставляется ни одна строка.
+func BulkInsertTypeSamples(ctx context.Context, pool *pgxpool.Pool, samples []TypeSample) (int64, error) {
+	if len(samples) == 0 {
+		return 0, nil
+	}
+	n, err := pool.CopyFrom(ctx, pgx.Identifier{"type_samples"}, typeSampleColumns, newTypeSampleSource(samples))
+	if err != nil {
+		return 0, pgerr.Classify(err)
+	}
+	return n, nil
+}
+
+// typeSampleSource — потоковый pgx.CopyFromSource: строка для COPY собирается только
+// в момент Values, поэтому промежуточный [][]any на весь набор не строится.
+type typeSampleSource struct {
+	rows []TypeSample
+	idx  int
+}
+
+func newTypeSampleSource(rows []TypeSample) *typeSampleSource {
+	return &typeSampleSource{rows: rows, idx: -1}
+}
+
+func (s *typeSampleSource) Next() bool {
+	s.idx++
+	return s.idx < len(s.rows)
+}
+
+func (s *typeSampleSource) Values() ([]any, error) {
+	r := s.rows[s.idx]
+	return []any{r.UUID, r.I2, r.I4, r.I8, r.Flag, r.Note, r.Num, r.TS}, nil
+}
+
+func (s *typeSampleSource) Err() error { return nil }
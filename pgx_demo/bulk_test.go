@@ -0,0 +1,43 @@
+package pgx_demo
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestTypeSampleSource(t *testing.T) {
+	rows := []TypeSample{
+		{I4: pgtype.Int4{Int32: 1, Valid: true}, Note: pgtype.Text{String: "a", Valid: true}},
+		{I4: pgtype.Int4{Int32: 2, Valid: true}}, // Note = NULL
+	}
+	src := newTypeSampleSource(rows)
+
+	var got []int32
+	for src.Next() {
+		vals, err := src.Values()
+		if err != nil {
+			t.Fatalf("Values: %v", err)
+		}
+		if len(vals) != len(typeSampleColumns) {
+			t.Fatalf("len(Values) = %d, want %d", len(vals), len(typeSampleColumns))
+		}
+		got = append(got, vals[2].(pgtype.Int4).Int32)
+		if i := len(got) - 1; vals[5].(pgtype.Text) != rows[i].Note {
+			t.Errorf("row %d note = %v, want %v", i, vals[5], rows[i].Note)
+		}
+	}
+	if src.Err() != nil || len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Fatalf("streamed %v (err %v), want [1 2]", got, src.Err())
+	}
+	if src.Next() {
+		t.Error("Next after end must stay false")
+	}
+}
+
+func TestTypeSampleColumnsMatchMapping(t *testing.T) {
+	// COPY пишет те же колонки, что читает GetTypeSample.
+	if err := CheckRowMapping[TypeSample](fields(typeSampleColumns...)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,180 @@
+// ClusterPool — один primary и N реплик, у каждого свой *pgxpool.Pool из BuildPool.
+// Чтения (GetBalance, DemoScanWithPgtype и т.п.) идут в Reader(ctx) — реплику по выбранной стратегии,
+// записи и транзакции — в primary (Writer / WithTx).
+// Read-your-writes: сессия (ctx из Session) после записи «прилипает» к primary на окно
+// ClusterOptions.ReadYourWritesWindow — реплика могла ещё не догнать только что записанное.
+//
+//	cluster, _ := NewClusterPool(ctx, primaryDSN, []string{replicaDSN}, ClusterOptions{ReadYourWritesWindow: time.Second})
+//	ctx = cluster.Session(ctx)
+//	_ = EnsureAccount(ctx, cluster.Writer(ctx), id)   // primary, сессия помечена
+//	bal, _ := GetBalance(ctx, cluster.Reader(ctx), id) // в течение окна — тоже primary
+
+package pgx_demo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Balancer — стратегия выбора реплики для чтения.
+type Balancer int
+
+const (
+	// RoundRobin — реплики по кругу.
+	RoundRobin Balancer = iota
+	// LeastConns — реплика с наименьшим числом выданных соединений (Stat().AcquiredConns()).
+	LeastConns
+)
+
+// ClusterOptions — настройки ClusterPool.
+type ClusterOptions struct {
+	Balance Balancer
+	// ReadYourWritesWindow — сколько после записи читать сессии из primary. 0 — не прилипать.
+	ReadYourWritesWindow time.Duration
+	// PoolOptions — опции BuildPool для primary и всех реплик.
+	PoolOptions []PoolOption
+}
+
+// ClusterPool — пулы primary и реплик с маршрутизацией чтений/записей.
+type ClusterPool struct {
+	primary  *pgxpool.Pool
+	replicas []*pgxpool.Pool
+	opts     ClusterOptions
+	rr       atomic.Uint64
+	now      func() time.Time
+}
+
+// NewClusterPool — пулы для primaryDSN и каждого из replicaDSNs. Без реплик все чтения идут в primary.
+// Для проверки на одном инстансе достаточно передать тот же сервер под другим DSN.
+func NewClusterPool(ctx context.Context, primaryDSN string, replicaDSNs []string, opts ClusterOptions) (*ClusterPool, error) {
+	primary, err := BuildPool(ctx, primaryDSN, opts.PoolOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("primary: %w", err)
+	}
+	replicas := make([]*pgxpool.Pool, 0, len(replicaDSNs))
+	for i, dsn := range replicaDSNs {
+		p, err := BuildPool(ctx, dsn, opts.PoolOptions...)
+		if err != nil {
+			primary.Close()
+			for _, r := range replicas {
+				r.Close()
+			}
+			return nil, fmt.Errorf("replica %d: %w", i, err)
+		}
+		replicas = append(replicas, p)
+	}
+	return newClusterPool(primary, replicas, opts), nil
+}
+
+func newClusterPool(primary *pgxpool.Pool, replicas []*pgxpool.Pool, opts ClusterOptions) *ClusterPool {
+	return &ClusterPool{primary: primary, replicas: replicas, opts: opts, now: time.Now}
+}
+
+// Primary — пул primary без пометки сессии (для служебных задач: миграции, health-check).
+func (c *ClusterPool) Primary() *pgxpool.Pool { return c.primary }
+
+// Replicas — пулы реплик в порядке DSN.
+func (c *ClusterPool) Replicas() []*pgxpool.Pool { return append([]*pgxpool.Pool(nil), c.replicas...) }
+
+type clusterSessionKey struct{}
+
+// clusterSession — время последней записи сессии (UnixNano; 0 — записей не было).
+type clusterSession struct {
+	lastWrite atomic.Int64
+}
+
+// Session — контекст с сессией read-your-writes. Без сессии Reader всегда выбирает реплику.
+// Если в ctx уже есть сессия, он возвращается как есть.
+func (c *ClusterPool) Session(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(clusterSessionKey{}).(*clusterSession); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, clusterSessionKey{}, &clusterSession{})
+}
+
+// Writer — пул primary; помечает сессию записью (окно read-your-writes отсчитывается от вызова).
+func (c *ClusterPool) Writer(ctx context.Context) *pgxpool.Pool {
+	c.markWrite(ctx)
+	return c.primary
+}
+
+// Reader — пул для чтения: primary, если реплик нет или сессия недавно писала, иначе реплика по Balance.
+func (c *ClusterPool) Reader(ctx context.Context) *pgxpool.Pool {
+	if len(c.replicas) == 0 || c.pinned(ctx) {
+		return c.primary
+	}
+	switch c.opts.Balance {
+	case LeastConns:
+		loads := make([]int32, len(c.replicas))
+		for i, r := range c.replicas {
+			loads[i] = r.Stat().AcquiredConns()
+		}
+		return c.replicas[pickLeast(loads, int(c.rr.Add(1)))]
+	default:
+		return c.replicas[int((c.rr.Add(1)-1)%uint64(len(c.replicas)))]
+	}
+}
+
+// WithTx — транзакция на primary (см. WithTx); сессия помечается записью и до, и после транзакции,
+// чтобы окно read-your-writes отсчитывалось от COMMIT.
+func (c *ClusterPool) WithTx(ctx context.Context, opts TxOptions, fn func(pgx.Tx) error) error {
+	err := WithTx(ctx, c.Writer(ctx), opts, fn)
+	c.markWrite(ctx)
+	return err
+}
+
+// Close — закрыть все пулы.
+func (c *ClusterPool) Close() {
+	c.primary.Close()
+	for _, r := range c.replicas {
+		r.Close()
+	}
+}
+
+// Ping — проверить primary и все реплики; ошибки собираются вместе.
+func (c *ClusterPool) Ping(ctx context.Context) error {
+	var errs []error
+	if err := c.primary.Ping(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("primary: %w", err))
+	}
+	for i, r := range c.replicas {
+		if err := r.Ping(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("replica %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *ClusterPool) markWrite(ctx context.Context) {
+	if s, ok := ctx.Value(clusterSessionKey{}).(*clusterSession); ok {
+		s.lastWrite.Store(c.now().UnixNano())
+	}
+}
+
+func (c *ClusterPool) pinned(ctx context.Context) bool {
+	s, ok := ctx.Value(clusterSessionKey{}).(*clusterSession)
+	if !ok || c.opts.ReadYourWritesWindow <= 0 {
+		return false
+	}
+	last := s.lastWrite.Load()
+	return last != 0 && c.now().Sub(time.Unix(0, last)) < c.opts.ReadYourWritesWindow
+}
+
+// pickLeast — индекс минимальной нагрузки; при равенстве обход начинается со start,
+// чтобы равные реплики получали запросы по очереди.
+func pickLeast(loads []int32, start int) int {
+	best := -1
+	for i := range loads {
+		j := (start + i) % len(loads)
+		if best < 0 || loads[j] < loads[best] {
+			best = j
+		}
+	}
+	return best
+}
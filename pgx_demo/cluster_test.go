@@ -0,0 +1,86 @@
+package pgx_demo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// lazyPool — пул без соединений: MinConns=0, поэтому до первого Acquire к серверу никто не ходит.
+func lazyPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	p, err := BuildPool(context.Background(), testDSN, WithMinConns(0), WithMinIdleConns(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(p.Close)
+	return p
+}
+
+func TestClusterPoolRoundRobin(t *testing.T) {
+	primary, r1, r2 := lazyPool(t), lazyPool(t), lazyPool(t)
+	c := newClusterPool(primary, []*pgxpool.Pool{r1, r2}, ClusterOptions{})
+	ctx := context.Background()
+
+	got := []*pgxpool.Pool{c.Reader(ctx), c.Reader(ctx), c.Reader(ctx)}
+	if got[0] != r1 || got[1] != r2 || got[2] != r1 {
+		t.Error("Reader must alternate replicas")
+	}
+	if c.Writer(ctx) != primary {
+		t.Error("Writer must return primary")
+	}
+	// Без сессии запись не влияет на чтения.
+	if c.Reader(ctx) == primary {
+		t.Error("read without session went to primary")
+	}
+
+	if c := newClusterPool(primary, nil, ClusterOptions{}); c.Reader(ctx) != primary {
+		t.Error("without replicas reads must go to primary")
+	}
+}
+
+func TestClusterPoolReadYourWrites(t *testing.T) {
+	primary, replica := lazyPool(t), lazyPool(t)
+	c := newClusterPool(primary, []*pgxpool.Pool{replica}, ClusterOptions{ReadYourWritesWindow: time.Second})
+	now := time.Unix(1000, 0)
+	c.now = func() time.Time { return now }
+
+	ctx := c.Session(context.Background())
+	if c.Reader(ctx) != replica {
+		t.Fatal("session without writes must read from replica")
+	}
+	c.Writer(ctx)
+	if c.Reader(ctx) != primary {
+		t.Fatal("read right after write must be pinned to primary")
+	}
+	// Другая сессия не затронута.
+	if c.Reader(c.Session(context.Background())) != replica {
+		t.Error("pin leaked into another session")
+	}
+	now = now.Add(time.Second)
+	if c.Reader(ctx) != replica {
+		t.Error("pin must expire after the window")
+	}
+	if c.Session(ctx) != ctx {
+		t.Error("Session must keep an existing session")
+	}
+}
+
+func TestPickLeast(t *testing.T) {
+	for _, tc := range []struct {
+		loads []int32
+		start int
+		want  int
+	}{
+		{[]int32{3, 1, 2}, 0, 1},
+		{[]int32{0, 0, 0}, 0, 0},
+		{[]int32{0, 0, 0}, 2, 2}, // при равенстве — по очереди
+		{[]int32{5, 0, 0}, 4, 1},
+	} {
+		if got := pickLeast(tc.loads, tc.start); got != tc.want {
+			t.Errorf("pickLeast(%v, %d) = %d, want %d", tc.loads, tc.start, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+// Ротация учётных данных: пароль из DSN фиксируется в ParseConfig, а в проде он меняется
+// (секрет в файле, обновляемом раз в час, или выдача внешней командой).
+// CredentialRotator берёт пароль у CredentialProvider в BeforeConnect — каждое новое соединение
+// подключается с актуальным паролем, — а соединения, открытые со старым паролем, выбрасываются
+// при следующей выдаче (BeforeAcquire) или возврате (AfterRelease), а простаивающие — сразу после
+// ротации (Run/Recycle). Выданные сессии смена пароля не обрывает, поэтому начатая работа на них доделывается.
+//
+//	creds := NewCredentialRotator(FileCredentials("/run/secrets/pg_password"))
+//	pool, _ := BuildPool(ctx, dsn, WithCredentials(creds))
+//	go creds.Run(ctx, pool, time.Minute) // замечать ротацию и закрывать простаивающие соединения
+
+package pgx_demo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Credentials — логин и пароль. Пустой User — пользователь из DSN.
+type Credentials struct {
+	User     string
+	Password string
+}
+
+// CredentialProvider — источник актуальных учётных данных. Вызывается на каждое новое соединение,
+// поэтому дорогие источники должны кэшировать результат сами (см. CommandCredentials).
+type CredentialProvider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+// CredentialProviderFunc — функция как CredentialProvider.
+type CredentialProviderFunc func(ctx context.Context) (Credentials, error)
+
+func (f CredentialProviderFunc) Credentials(ctx context.Context) (Credentials, error) { return f(ctx) }
+
+// StaticCredentials — неизменные учётные данные (тесты, локальная разработка).
+func StaticCredentials(user, password string) CredentialProvider {
+	return CredentialProviderFunc(func(context.Context) (Credentials, error) {
+		return Credentials{User: user, Password: password}, nil
+	})
+}
+
+// FileCredentials — пароль из файла (Docker/Kubernetes secret). Файл перечитывается,
+// только когда меняются его размер или время изменения.
+func FileCredentials(path string) CredentialProvider {
+	var (
+		mu      sync.Mutex
+		modTime time.Time
+		size    int64
+		cached  Credentials
+	)
+	return CredentialProviderFunc(func(context.Context) (Credentials, error) {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return Credentials{}, err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if fi.ModTime().Equal(modTime) && fi.Size() == size {
+			return cached, nil
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return Credentials{}, err
+		}
+		cached = Credentials{Password: strings.TrimRight(string(b), "\r\n")}
+		modTime, size = fi.ModTime(), fi.Size()
+		return cached, nil
+	})
+}
+
+// CommandCredentials — пароль из stdout команды (vault read, aws rds generate-db-auth-token, ...).
+// Результат кэшируется на ttl, чтобы не запускать процесс на каждое соединение.
+func CommandCredentials(ttl time.Duration, name string, args ...string) CredentialProvider {
+	var (
+		mu      sync.Mutex
+		fetched time.Time
+		cached  Credentials
+	)
+	return CredentialProviderFunc(func(ctx context.Context) (Credentials, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !fetched.IsZero() && time.Since(fetched) < ttl {
+			return cached, nil
+		}
+		var stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, name, args...)
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return Credentials{}, fmt.Errorf("credentials command %s: %w: %s", name, err, strings.TrimSpace(stderr.String()))
+		}
+		cached = Credentials{Password: strings.TrimRight(string(out), "\r\n")}
+		fetched = time.Now()
+		return cached, nil
+	})
+}
+
+// CredentialStats — счётчики ротатора.
+type CredentialStats struct {
+	Rotations int64 // сколько раз менялись учётные данные
+	Recycled  int64 // сколько соединений со старыми учётными данными выброшено
+	Failures  int64 // ошибки провайдера
+}
+
+// CredentialRotator — учётные данные пула из CredentialProvider. Подключается через WithCredentials.
+type CredentialRotator struct {
+	provider CredentialProvider
+	// OnRotate — вызывается при смене учётных данных (сами данные не передаются, чтобы не попасть в лог).
+	OnRotate func()
+
+	mu      sync.Mutex
+	current Credentials
+	known   bool
+	stats   CredentialStats
+
+	recycle func(ctx context.Context, pool *pgxpool.Pool) // подменяется в тестах
+}
+
+// NewCredentialRotator — ротатор поверх p.
+func NewCredentialRotator(p CredentialProvider) *CredentialRotator {
+	r := &CredentialRotator{provider: p}
+	r.recycle = r.Recycle
+	return r
+}
+
+// WithCredentials — брать учётные данные у r: BeforeConnect подставляет их в ConnConfig,
+// BeforeAcquire/AfterRelease выбрасывают соединения, открытые со старыми.
+func WithCredentials(r *CredentialRotator) PoolOption {
+	return WithHooks(Hooks{
+		BeforeConnect: r.apply,
+		AfterConnect: func(_ context.Context, conn *pgx.Conn) error {
+			cfg := conn.Config()
+			conn.PgConn().CustomData()[credentialsKey] = Credentials{User: cfg.User, Password: cfg.Password}
+			return nil
+		},
+		BeforeAcquire: func(_ context.Context, conn *pgx.Conn) bool { return !r.staleConn(conn) },
+		AfterRelease:  func(conn *pgx.Conn) bool { return !r.staleConn(conn) },
+	})
+}
+
+// credentialsKey — ключ в pgconn.PgConn.CustomData(): с какими учётными данными открыто соединение
+// (conn.Config() каждый раз копирует весь конфиг, поэтому запоминаем их один раз в AfterConnect).
+const credentialsKey = "pgx_demo.credentials"
+
+func (r *CredentialRotator) staleConn(conn *pgx.Conn) bool {
+	used, ok := conn.PgConn().CustomData()[credentialsKey].(Credentials)
+	return ok && r.stale(used)
+}
+
+// Refresh — запросить учётные данные у провайдера и запомнить их.
+// При ошибке остаются прежние: соединения продолжают открываться со старым паролем, пока он действует.
+func (r *CredentialRotator) Refresh(ctx context.Context) (Credentials, error) {
+	c, err := r.provider.Credentials(ctx)
+	r.mu.Lock()
+	if err != nil {
+		r.stats.Failures++
+		prev, known := r.current, r.known
+		r.mu.Unlock()
+		if known {
+			return prev, nil
+		}
+		return Credentials{}, fmt.Errorf("credentials: %w", err)
+	}
+	rotated := r.known && c != r.current
+	r.current, r.known = c, true
+	if rotated {
+		r.stats.Rotations++
+	}
+	r.mu.Unlock()
+	if rotated && r.OnRotate != nil {
+		r.OnRotate()
+	}
+	return c, nil
+}
+
+// Run — Refresh раз в interval, пока не отменён ctx: ротация замечается и без новых подключений.
+// После каждой ротации (замеченной здесь или в BeforeConnect) простаивающие соединения pool
+// со старыми учётными данными закрываются через Recycle. pool == nil — только Refresh.
+func (r *CredentialRotator) Run(ctx context.Context, pool *pgxpool.Pool, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	recycled := r.Stats().Rotations
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			_, _ = r.Refresh(ctx)
+			if rotations := r.Stats().Rotations; pool != nil && rotations != recycled {
+				r.recycle(ctx, pool)
+				recycled = rotations
+			}
+		}
+	}
+}
+
+// Recycle — закрыть простаивающие соединения pool, открытые со старыми учётными данными,
+// не дожидаясь, пока их кто-нибудь запросит. Остальные простаивающие возвращаются в пул.
+// Выданные соединения не трогаются: они выбрасываются при возврате (AfterRelease).
+func (r *CredentialRotator) Recycle(ctx context.Context, pool *pgxpool.Pool) {
+	// AcquireAllIdle вызывает BeforeAcquire пула, поэтому с WithCredentials устаревшие соединения
+	// уничтожаются уже там; проверка ниже — для пулов, где хуки собраны иначе.
+	for _, c := range pool.AcquireAllIdle(ctx) {
+		if r.staleConn(c.Conn()) {
+			_ = c.Hijack().Close(ctx)
+			continue
+		}
+		c.Release()
+	}
+}
+
+// Stats — счётчики ротаций, выброшенных соединений и ошибок провайдера.
+func (r *CredentialRotator) Stats() CredentialStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
+
+// apply — BeforeConnect: актуальные учётные данные в конфиг нового соединения.
+func (r *CredentialRotator) apply(ctx context.Context, cfg *pgx.ConnConfig) error {
+	c, err := r.Refresh(ctx)
+	if err != nil {
+		return err
+	}
+	if c.User != "" {
+		cfg.User = c.User
+	}
+	cfg.Password = c.Password
+	return nil
+}
+
+// stale — соединение, открытое с used, нужно выбросить: учётные данные с тех пор сменились.
+func (r *CredentialRotator) stale(used Credentials) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.known {
+		return false
+	}
+	if used.Password == r.current.Password && (r.current.User == "" || used.User == r.current.User) {
+		return false
+	}
+	r.stats.Recycled++
+	return true
+}
@@ -0,0 +1,260 @@
+package pgx_demo
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// writeSecret — записать пароль и сдвинуть mtime: на быстрых ФС две записи подряд иначе неразличимы.
+func writeSecret(t *testing.T, path, password string, at time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(password+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, at, at); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pg_password")
+	at := time.Unix(1000, 0)
+	writeSecret(t, path, "first", at)
+	p := FileCredentials(path)
+	ctx := context.Background()
+
+	if c, err := p.Credentials(ctx); err != nil || c.Password != "first" || c.User != "" {
+		t.Fatalf("Credentials = %+v, %v", c, err)
+	}
+	writeSecret(t, path, "second", at.Add(time.Hour))
+	if c, _ := p.Credentials(ctx); c.Password != "second" {
+		t.Fatalf("rotated password not picked up: %q", c.Password)
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Credentials(ctx); err == nil {
+		t.Error("missing file must fail")
+	}
+}
+
+func TestCommandCredentials(t *testing.T) {
+	p := CommandCredentials(time.Minute, "echo", "s3cret")
+	if c, err := p.Credentials(context.Background()); err != nil || c.Password != "s3cret" {
+		t.Fatalf("Credentials = %+v, %v", c, err)
+	}
+	if _, err := CommandCredentials(time.Minute, "false").Credentials(context.Background()); err == nil {
+		t.Error("failing command must fail")
+	}
+}
+
+func TestCredentialRotator(t *testing.T) {
+	current := Credentials{User: "app", Password: "first"}
+	var fail error
+	rotations := 0
+	r := NewCredentialRotator(CredentialProviderFunc(func(context.Context) (Credentials, error) { return current, fail }))
+	r.OnRotate = func() { rotations++ }
+	ctx := context.Background()
+
+	cfg := &pgx.ConnConfig{}
+	if err := r.apply(ctx, cfg); err != nil || cfg.User != "app" || cfg.Password != "first" {
+		t.Fatalf("apply: %+v %v", cfg, err)
+	}
+	old := Credentials{User: cfg.User, Password: cfg.Password}
+	if r.stale(old) {
+		t.Fatal("fresh conn reported stale")
+	}
+
+	current.Password = "second"
+	if _, err := r.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !r.stale(old) || r.stale(Credentials{User: "app", Password: "second"}) {
+		t.Fatal("only the conn opened with the old password must be recycled")
+	}
+
+	// Провайдер сломался — продолжаем с последними известными учётными данными.
+	fail = errors.New("vault unavailable")
+	if c, err := r.Refresh(ctx); err != nil || c.Password != "second" {
+		t.Fatalf("Refresh with failing provider = %+v, %v", c, err)
+	}
+	if st := r.Stats(); st.Rotations != 1 || st.Recycled != 1 || st.Failures != 1 || rotations != 1 {
+		t.Errorf("stats = %+v, OnRotate calls = %d", st, rotations)
+	}
+
+	// Без единого успешного ответа подключаться не с чем.
+	empty := NewCredentialRotator(CredentialProviderFunc(func(context.Context) (Credentials, error) { return Credentials{}, fail }))
+	if err := empty.apply(ctx, &pgx.ConnConfig{}); !errors.Is(err, fail) {
+		t.Errorf("apply without credentials = %v", err)
+	}
+}
+
+func TestCredentialRotatorRunRecycles(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		password = "first"
+		calls    int
+	)
+	r := NewCredentialRotator(CredentialProviderFunc(func(context.Context) (Credentials, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		return Credentials{Password: password}, nil
+	}))
+	recycled := make(chan *pgxpool.Pool, 10)
+	r.recycle = func(_ context.Context, pool *pgxpool.Pool) { recycled <- pool }
+	refreshed := func() int { mu.Lock(); defer mu.Unlock(); return calls }
+
+	pool := &pgxpool.Pool{}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { r.Run(ctx, pool, time.Millisecond); close(done) }()
+	defer func() { cancel(); <-done }()
+
+	// Refresh без смены пароля — не ротация: простаивающие соединения не трогаем.
+	for deadline := time.Now().Add(time.Second); refreshed() < 3 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if len(recycled) != 0 || r.Stats().Rotations != 0 {
+		t.Fatal("Recycle before any rotation")
+	}
+
+	mu.Lock()
+	password = "second"
+	mu.Unlock()
+	select {
+	case got := <-recycled:
+		if got != pool {
+			t.Fatalf("Recycle got pool %p, want %p", got, pool)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("rotation did not trigger Recycle")
+	}
+	for n := refreshed() + 3; refreshed() < n; {
+		time.Sleep(time.Millisecond)
+	}
+	if n := len(recycled); n != 0 {
+		t.Errorf("Recycle called %d more times without a new rotation", n)
+	}
+}
+
+// rotationRole — роль, которую создают и удаляют живые тесты ротации.
+const rotationRole = "pgx_demo_rotation"
+
+// rotationFixture — роль role с паролем "first", файл-секрет и пул из одного ротатора (PGTEST_URL — DSN
+// суперпользователя). rotate меняет пароль роли и секрет на "second".
+func rotationFixture(t *testing.T) (ctx context.Context, r *CredentialRotator, pool *pgxpool.Pool, rotate func()) {
+	adminDSN := os.Getenv("PGTEST_URL")
+	if adminDSN == "" {
+		t.Skip("PGTEST_URL not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	t.Cleanup(cancel)
+	if err := BootstrapEnsureSchema(ctx, adminDSN); err != nil {
+		t.Fatal(err)
+	}
+	admin, err := pgx.Connect(ctx, adminDSN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close(context.Background()) })
+
+	exec := func(sql string) {
+		t.Helper()
+		if _, err := admin.Exec(ctx, sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+	exec("DROP ROLE IF EXISTS " + rotationRole)
+	exec("CREATE ROLE " + rotationRole + " LOGIN PASSWORD 'first'")
+	t.Cleanup(func() { admin.Exec(context.Background(), "DROP ROLE IF EXISTS "+rotationRole) })
+
+	path := filepath.Join(t.TempDir(), "pg_password")
+	writeSecret(t, path, "first", time.Now())
+	file := FileCredentials(path)
+	r = NewCredentialRotator(CredentialProviderFunc(func(ctx context.Context) (Credentials, error) {
+		c, err := file.Credentials(ctx)
+		c.User = rotationRole
+		return c, err
+	}))
+	pool, err = BuildPool(ctx, adminDSN, WithMinConns(0), WithMinIdleConns(0), WithMaxConns(2), WithCredentials(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	rotate = func() {
+		exec("ALTER ROLE " + rotationRole + " PASSWORD 'second'")
+		writeSecret(t, path, "second", time.Now().Add(time.Hour))
+	}
+	return ctx, r, pool, rotate
+}
+
+// TestCredentialRotationLive — ротация против живого Postgres: новые соединения открываются с новым
+// паролем, выданное со старым доживает до Release и выбрасывается.
+func TestCredentialRotationLive(t *testing.T) {
+	ctx, r, pool, rotate := rotationFixture(t)
+
+	held, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotate()
+
+	var user string
+	if err := pool.QueryRow(ctx, "SELECT current_user").Scan(&user); err != nil || user != rotationRole {
+		t.Fatalf("query after rotation: user=%q err=%v", user, err)
+	}
+	if err := held.Ping(ctx); err != nil {
+		t.Fatalf("old session must survive rotation: %v", err)
+	}
+	held.Release()
+	deadline := time.Now().Add(5 * time.Second)
+	for r.Stats().Recycled == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond) // AfterRelease выполняется в отдельной горутине
+	}
+	if st := r.Stats(); st.Rotations != 1 || st.Recycled != 1 {
+		t.Errorf("stats = %+v, want 1 rotation and 1 recycled conn", st)
+	}
+}
+
+// TestCredentialRecycleIdleLive — простаивающее соединение со старым паролем закрывается Run сразу
+// после ротации, хотя его никто не запрашивает.
+func TestCredentialRecycleIdleLive(t *testing.T) {
+	ctx, r, pool, rotate := rotationFixture(t)
+	if err := pool.Ping(ctx); err != nil { // одно соединение со старым паролем остаётся в пуле простаивать
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); pool.Stat().IdleConns() != 1 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond) // AfterRelease выполняется в отдельной горутине
+	}
+	if st := pool.Stat(); st.IdleConns() != 1 {
+		t.Fatalf("idle conns = %d, want 1", st.IdleConns())
+	}
+
+	runCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() { r.Run(runCtx, pool, 10*time.Millisecond); close(done) }()
+	defer func() { stop(); <-done }()
+	rotate()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for pool.Stat().TotalConns() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if st := pool.Stat(); st.TotalConns() != 0 || st.AcquireCount() != 1 {
+		t.Fatalf("total conns = %d, acquires = %d: idle stale conn must be closed without an Acquire",
+			st.TotalConns(), st.AcquireCount())
+	}
+	if st := r.Stats(); st.Rotations != 1 || st.Recycled != 1 {
+		t.Errorf("stats = %+v, want 1 rotation and 1 recycled conn", st)
+	}
+}
@@ -0,0 +1,258 @@
+// Failover для multi-host DSN (host=a,b,c или postgres://a,b/db).
+// pgx сам перебирает хосты при подключении; ValidateConnect (target_session_attrs) решает, какой подходит.
+// Но уже открытые соединения об этом не знают: после switchover старый primary становится standby,
+// и соединения пула к нему продолжают выдаваться. WithFailover:
+//   - если в DSN нет target_session_attrs, требует primary при подключении; значения, допускающие standby
+//     (any, standby, read-only, prefer-standby), отклоняются — иначе пул бесконечно выбрасывал бы соединения;
+//   - в BeforeAcquire проверяет pg_is_in_recovery() (не чаще CheckInterval на соединение)
+//     и выбрасывает соединения, оказавшиеся на standby, — пул переподключится к новому primary;
+//   - при смене primary перепроверяет все соединения и сообщает о событиях в OnEvent.
+
+package pgx_demo
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// defaultFailoverCheckInterval — как часто одно соединение проверяется на pg_is_in_recovery().
+const defaultFailoverCheckInterval = 5 * time.Second
+
+// FailoverEventKind — тип события failover.
+type FailoverEventKind string
+
+const (
+	// FailoverStandbyEvicted — соединение оказалось на standby и выброшено из пула.
+	FailoverStandbyEvicted FailoverEventKind = "standby_evicted"
+	// FailoverPrimaryChanged — новое соединение установлено к другому хосту, чем прежний primary.
+	FailoverPrimaryChanged FailoverEventKind = "primary_changed"
+	// FailoverCheckFailed — проверка pg_is_in_recovery() не удалась; соединение выброшено.
+	FailoverCheckFailed FailoverEventKind = "check_failed"
+)
+
+// FailoverEvent — событие для FailoverOptions.OnEvent.
+type FailoverEvent struct {
+	Kind     FailoverEventKind
+	Host     string // адрес сервера соединения (ip:port)
+	PrevHost string // для FailoverPrimaryChanged — прежний primary
+	PID      uint32
+	Err      error
+	At       time.Time
+}
+
+// FailoverOptions — настройки WithFailover.
+type FailoverOptions struct {
+	// CheckInterval — минимальный интервал между проверками одного соединения. 0 — 5s.
+	CheckInterval time.Duration
+	// OnEvent — наблюдатель событий. Вызывается синхронно из хуков пула — не блокируйте его.
+	OnEvent func(FailoverEvent)
+}
+
+// WithFailover — отслеживание смены primary для multi-host DSN.
+func WithFailover(opts FailoverOptions) PoolOption {
+	return func(o *poolOptions) { o.failover = &opts }
+}
+
+// Ключи в pgconn.PgConn.CustomData().
+const (
+	failoverCheckedKey = "pgx_demo.failover.checked" // time.Time последней проверки
+	failoverGenKey     = "pgx_demo.failover.gen"     // поколение primary на момент проверки
+)
+
+// failoverMonitor — общее состояние хуков одного пула.
+type failoverMonitor struct {
+	opts FailoverOptions
+	now  func() time.Time
+
+	mu      sync.Mutex
+	primary string
+	gen     uint64 // растёт при каждой смене primary: соединения прошлых поколений перепроверяются
+	standby map[string]bool
+}
+
+// newFailoverMonitor — монитор для cfg; если target_session_attrs не задан явно, требует primary.
+// Любое другое значение, кроме primary и read-write, — ErrInvalidPoolConfig: пул подключался бы к standby,
+// а admit тут же выбрасывал бы такие соединения.
+func newFailoverMonitor(cfg *pgxpool.Config, dsn string, opts FailoverOptions) (*failoverMonitor, error) {
+	switch tsa := targetSessionAttrs(dsn); tsa {
+	case "":
+		if cfg.ConnConfig.ValidateConnect == nil {
+			cfg.ConnConfig.ValidateConnect = pgconn.ValidateConnectTargetSessionAttrsPrimary
+		}
+	case "primary", "read-write":
+	default:
+		return nil, fmt.Errorf("%w: WithFailover requires target_session_attrs primary or read-write, got %q", ErrInvalidPoolConfig, tsa)
+	}
+	if opts.CheckInterval <= 0 {
+		opts.CheckInterval = defaultFailoverCheckInterval
+	}
+	return &failoverMonitor{opts: opts, now: time.Now, standby: make(map[string]bool)}, nil
+}
+
+// targetSessionAttrs — явно заданный target_session_attrs (DSN, затем PGTARGETSESSIONATTRS) или "".
+// Значение к этому моменту уже проверено pgconn.ParseConfig; здесь важно лишь, задано ли оно явно,
+// а этого разобранный конфиг не хранит (target_session_attrs не попадает в RuntimeParams).
+func targetSessionAttrs(dsn string) string {
+	if v, ok := dsnSetting(dsn, "target_session_attrs"); ok {
+		return v
+	}
+	return os.Getenv("PGTARGETSESSIONATTRS")
+}
+
+// dsnSetting — значение параметра key из DSN по тем же правилам, что у pgconn (libpq):
+// URL — параметр запроса; keyword/value — пробелы вокруг '=', значения в кавычках и экранирование '\'.
+func dsnSetting(dsn, key string) (string, bool) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", false
+		}
+		q := u.Query()
+		return q.Get(key), q.Has(key)
+	}
+
+	var (
+		val   string
+		found bool
+	)
+	s := strings.TrimSpace(dsn)
+	for s != "" {
+		eq := strings.IndexRune(s, '=')
+		if eq < 0 {
+			return "", false
+		}
+		k := strings.TrimSpace(s[:eq])
+		s = strings.TrimLeft(s[eq+1:], " \t\n\r\v\f")
+
+		var v strings.Builder
+		quoted := strings.HasPrefix(s, "'")
+		if quoted {
+			s = s[1:]
+		}
+		i := 0
+		for ; i < len(s); i++ {
+			c := s[i]
+			if c == '\\' && i+1 < len(s) {
+				i++
+				v.WriteByte(s[i])
+				continue
+			}
+			if quoted && c == '\'' || !quoted && unicode.IsSpace(rune(c)) {
+				break
+			}
+			v.WriteByte(c)
+		}
+		if quoted {
+			if i >= len(s) {
+				return "", false // незакрытая кавычка
+			}
+			i++
+		}
+		if k == key {
+			val, found = v.String(), true // как и в libpq, последнее вхождение побеждает
+		}
+		s = strings.TrimSpace(s[i:])
+	}
+	return val, found
+}
+
+func (m *failoverMonitor) hooks() Hooks {
+	return Hooks{
+		AfterConnect: func(_ context.Context, conn *pgx.Conn) error {
+			m.connected(connHost(conn), conn.PgConn().PID(), conn.PgConn().CustomData())
+			return nil
+		},
+		BeforeAcquire: func(ctx context.Context, conn *pgx.Conn) bool {
+			return m.admit(connHost(conn), conn.PgConn().PID(), conn.PgConn().CustomData(), func() (bool, error) {
+				var inRecovery bool
+				err := conn.QueryRow(ctx, "SELECT pg_is_in_recovery()").Scan(&inRecovery)
+				return inRecovery, err
+			})
+		},
+	}
+}
+
+func (m *failoverMonitor) emit(e FailoverEvent) {
+	if m.opts.OnEvent != nil {
+		e.At = m.now()
+		m.opts.OnEvent(e)
+	}
+}
+
+// connected — новое соединение к host (AfterConnect). data — CustomData соединения.
+func (m *failoverMonitor) connected(host string, pid uint32, data map[string]any) {
+	m.mu.Lock()
+	delete(m.standby, host)
+	prev := m.primary
+	if prev != host {
+		m.primary = host
+		if prev != "" {
+			m.gen++
+		}
+	}
+	gen := m.gen
+	m.mu.Unlock()
+
+	data[failoverCheckedKey] = m.now()
+	data[failoverGenKey] = gen
+	if prev != "" && prev != host {
+		m.emit(FailoverEvent{Kind: FailoverPrimaryChanged, Host: host, PrevHost: prev, PID: pid})
+	}
+}
+
+// admit — решение BeforeAcquire: false выбрасывает соединение. inRecovery выполняет pg_is_in_recovery().
+func (m *failoverMonitor) admit(host string, pid uint32, data map[string]any, inRecovery func() (bool, error)) bool {
+	m.mu.Lock()
+	standby, gen := m.standby[host], m.gen
+	m.mu.Unlock()
+	checked, _ := data[failoverCheckedKey].(time.Time)
+	connGen, _ := data[failoverGenKey].(uint64)
+	// Старые соединения к хосту, уже признанному standby, выбрасываем без запроса.
+	// Новое (ещё не проверенное) проверяем: хост мог снова стать primary.
+	if standby && !checked.IsZero() {
+		m.emit(FailoverEvent{Kind: FailoverStandbyEvicted, Host: host, PID: pid})
+		return false
+	}
+	if !checked.IsZero() && connGen == gen && m.now().Sub(checked) < m.opts.CheckInterval {
+		return true
+	}
+
+	recovering, err := inRecovery()
+	if err != nil {
+		m.emit(FailoverEvent{Kind: FailoverCheckFailed, Host: host, PID: pid, Err: err})
+		return false
+	}
+	if recovering {
+		m.mu.Lock()
+		m.standby[host] = true
+		m.mu.Unlock()
+		m.emit(FailoverEvent{Kind: FailoverStandbyEvicted, Host: host, PID: pid})
+		return false
+	}
+	if standby {
+		m.mu.Lock()
+		delete(m.standby, host)
+		m.mu.Unlock()
+	}
+	data[failoverCheckedKey] = m.now()
+	data[failoverGenKey] = gen
+	return true
+}
+
+// connHost — адрес сервера, к которому фактически подключено соединение (после перебора хостов).
+func connHost(conn *pgx.Conn) string {
+	if nc := conn.PgConn().Conn(); nc != nil {
+		return nc.RemoteAddr().String()
+	}
+	return conn.Config().Host
+}
@@ -0,0 +1,148 @@
+package pgx_demo
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestWithFailoverTargetSessionAttrs(t *testing.T) {
+	t.Setenv("PGTARGETSESSIONATTRS", "")
+	for _, tc := range []struct {
+		dsn    string
+		reject bool // target_session_attrs допускает standby — WithFailover отклоняет конфиг
+	}{
+		{"postgres://u:p@db1:5432,db2:5432/app", false}, // не задан — требуем primary
+		{"postgres://u:p@db1,db2/app?target_session_attrs=any", true},
+		{"postgres://u:p@db1,db2/app?target_session_attrs=read-write", false},
+		{"host=db1,db2 user=u dbname=app target_session_attrs=prefer-standby", true},
+		{"host=db1,db2 user=u dbname=app target_session_attrs=standby", true},
+		{"host=db1,db2 user=u dbname=app target_session_attrs = any", true},
+		{"host=db1,db2 user=u dbname=app target_session_attrs='any'", true},
+		{"host=db1,db2 user=u target_session_attrs = 'read-write' dbname=app", false},
+		// Текст внутри значения другого параметра — не target_session_attrs.
+		{"host=db1,db2 user=u options='-c application_name=target_session_attrs=any'", false},
+		{"postgres://u:p@db1,db2/app?application_name=target_session_attrs%3Dany", false},
+	} {
+		cfg, err := pgxpool.ParseConfig(tc.dsn)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.dsn, err)
+		}
+		_, err = newFailoverMonitor(cfg, tc.dsn, FailoverOptions{})
+		if tc.reject {
+			if !errors.Is(err, ErrInvalidPoolConfig) {
+				t.Errorf("%s: err = %v, want ErrInvalidPoolConfig", tc.dsn, err)
+			}
+			if _, err := BuildPoolConfig(tc.dsn, WithFailover(FailoverOptions{})); !errors.Is(err, ErrInvalidPoolConfig) {
+				t.Errorf("%s: BuildPoolConfig err = %v, want ErrInvalidPoolConfig", tc.dsn, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.dsn, err)
+		}
+		if cfg.ConnConfig.ValidateConnect == nil {
+			t.Errorf("%s: ValidateConnect not set, standby would be accepted", tc.dsn)
+		}
+	}
+
+	if cfg, err := BuildPoolConfig("postgres://u:p@db1,db2/app", WithFailover(FailoverOptions{})); err != nil || cfg.ConnConfig.ValidateConnect == nil {
+		t.Errorf("BuildPoolConfig with failover: err=%v, ValidateConnect missing", err)
+	}
+}
+
+func TestDSNSetting(t *testing.T) {
+	for _, tc := range []struct {
+		dsn, want string
+		found     bool
+	}{
+		{"host=db target_session_attrs=primary", "primary", true},
+		{"host=db   target_session_attrs  =   standby  ", "standby", true},
+		{`host=db target_session_attrs='read-write' password='it\'s secret'`, "read-write", true},
+		{`password='a b target_session_attrs=any' host=db`, "", false},
+		{`password=a\ target_session_attrs=any host=db`, "", false},
+		{"target_session_attrs=any target_session_attrs=primary", "primary", true},
+		{"postgresql://db/app?target_session_attrs=read-only", "read-only", true},
+		{"postgres://db/app", "", false},
+		{"host=db password='unterminated target_session_attrs=any", "", false},
+	} {
+		got, found := dsnSetting(tc.dsn, "target_session_attrs")
+		if got != tc.want || found != tc.found {
+			t.Errorf("dsnSetting(%q) = %q, %v; want %q, %v", tc.dsn, got, found, tc.want, tc.found)
+		}
+	}
+}
+
+// failoverHarness — монитор с ручными часами и записью событий.
+func failoverHarness() (*failoverMonitor, *[]FailoverEvent, *time.Time) {
+	var events []FailoverEvent
+	now := time.Unix(1000, 0)
+	m := &failoverMonitor{
+		opts:    FailoverOptions{CheckInterval: time.Second, OnEvent: func(e FailoverEvent) { events = append(events, e) }},
+		standby: make(map[string]bool),
+	}
+	m.now = func() time.Time { return now }
+	return m, &events, &now
+}
+
+func TestFailoverEvictsStandby(t *testing.T) {
+	m, events, now := failoverHarness()
+	checks := 0
+	recovering := false
+	check := func() (bool, error) { checks++; return recovering, nil }
+
+	conn := map[string]any{}
+	m.connected("db1:5432", 1, conn)
+	if !m.admit("db1:5432", 1, conn, check) || checks != 0 {
+		t.Fatalf("fresh validated conn must be admitted without a check (checks=%d)", checks)
+	}
+
+	// Проверка не чаще CheckInterval.
+	*now = now.Add(time.Second)
+	if !m.admit("db1:5432", 1, conn, check) || checks != 1 {
+		t.Fatalf("checks = %d, want 1", checks)
+	}
+
+	// db1 стал standby: соединение выбрасывается, остальные соединения к db1 — без запроса.
+	*now = now.Add(time.Second)
+	recovering = true
+	if m.admit("db1:5432", 1, conn, check) {
+		t.Fatal("standby conn admitted")
+	}
+	other := map[string]any{failoverCheckedKey: *now, failoverGenKey: uint64(0)}
+	if m.admit("db1:5432", 2, other, check) || checks != 2 {
+		t.Fatalf("second standby conn: checks = %d, want 2 (no extra query)", checks)
+	}
+	if len(*events) != 2 || (*events)[0].Kind != FailoverStandbyEvicted || (*events)[0].Host != "db1:5432" {
+		t.Fatalf("events = %+v", *events)
+	}
+
+	// Ошибка проверки — соединение выбрасывается.
+	if m.admit("db3:5432", 3, map[string]any{}, func() (bool, error) { return false, errors.New("broken") }) {
+		t.Error("conn with failed check admitted")
+	}
+	if last := (*events)[len(*events)-1]; last.Kind != FailoverCheckFailed || last.Err == nil {
+		t.Errorf("last event = %+v, want check_failed", last)
+	}
+}
+
+func TestFailoverPrimaryChangeRechecksOldConns(t *testing.T) {
+	m, events, _ := failoverHarness()
+	checks := 0
+	check := func() (bool, error) { checks++; return false, nil }
+
+	old := map[string]any{}
+	m.connected("db1:5432", 1, old)
+	m.connected("db2:5432", 2, map[string]any{})
+
+	if len(*events) != 1 || (*events)[0].Kind != FailoverPrimaryChanged ||
+		(*events)[0].PrevHost != "db1:5432" || (*events)[0].Host != "db2:5432" {
+		t.Fatalf("events = %+v", *events)
+	}
+	// Соединение прошлого поколения перепроверяется сразу, не дожидаясь CheckInterval.
+	if !m.admit("db1:5432", 1, old, check) || checks != 1 {
+		t.Fatalf("checks = %d, want an immediate recheck", checks)
+	}
+}
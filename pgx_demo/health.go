@@ -0,0 +1,247 @@
+// Политика здоровья соединений: какие соединения нельзя возвращать в пул / выдавать из пула.
+// Встроенные хуки BuildPool (BeforeAcquire/AfterRelease) спрашивают политику из WithHealthPolicy;
+// без неё они, как и раньше, пропускают всё.
+//
+// Соединение выбрасывается, если:
+//   - оно вернулось внутри открытой или упавшей транзакции (PgConn().TxStatus() 'T'/'E');
+//   - в сессии менялись GUC (SET/RESET/set_config(..., false) или изменился reported-параметр);
+//   - на нём выполнено больше MaxQueries запросов;
+//   - запрос на нём завершился фатальной ошибкой (FATAL/PANIC, обрыв соединения) или оно уже закрыто;
+//   - его отверг один из пользовательских Checks.
+//
+// Открытую транзакцию, закрытое и занятое соединение pgxpool выбрасывает сам, ещё до AfterRelease, —
+// такие случаи политика видит через pgxpool.ReleaseTracer и только считает.
+
+package pgx_demo
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"regexp"
+	"sync"
+
+	"github.com/MrTeeett/pgx-v5-pool-examples/pgx_demo/pgerr"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DiscardReason — причина выброса соединения. "" — соединение здорово.
+type DiscardReason string
+
+const (
+	DiscardOpenTransaction   DiscardReason = "open_transaction"   // TxStatus 'T'
+	DiscardFailedTransaction DiscardReason = "failed_transaction" // TxStatus 'E'
+	DiscardModifiedGUC       DiscardReason = "modified_guc"
+	DiscardQueryLimit        DiscardReason = "query_limit"
+	DiscardFatalError        DiscardReason = "fatal_error"
+)
+
+// ConnCheck — пользовательская проверка; непустая причина выбрасывает соединение.
+type ConnCheck func(conn *pgx.Conn) DiscardReason
+
+// trackedParams — параметры, о которых сервер сообщает клиенту (GUC_REPORT) и которые
+// не должны меняться за время жизни соединения пула. search_path сообщается с PostgreSQL 18.
+var trackedParams = []string{
+	"application_name", "client_encoding", "DateStyle", "IntervalStyle", "TimeZone",
+	"standard_conforming_strings", "session_authorization", "default_transaction_read_only", "search_path",
+}
+
+// HealthPolicy — политика здоровья. Нулевое значение проверяет транзакции, GUC и фатальные ошибки,
+// без лимита запросов. Подключается через WithHealthPolicy; один экземпляр — на один пул.
+type HealthPolicy struct {
+	// MaxQueries — после стольких запросов соединение пересоздаётся. 0 — без лимита.
+	MaxQueries int64
+	// Checks — дополнительные проверки, выполняются и при возврате, и перед выдачей.
+	Checks []ConnCheck
+
+	mu       sync.Mutex
+	discards map[DiscardReason]int64
+}
+
+// Discards — счётчики выброшенных соединений по причинам.
+func (p *HealthPolicy) Discards() map[DiscardReason]int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return maps.Clone(p.discards)
+}
+
+func (p *HealthPolicy) count(r DiscardReason) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discards == nil {
+		p.discards = make(map[DiscardReason]int64)
+	}
+	p.discards[r]++
+}
+
+// healthKey — ключ состояния в pgconn.PgConn.CustomData().
+const healthKey = "pgx_demo.health"
+
+// connHealth — наблюдения за одним соединением. Соединением в каждый момент владеет одна горутина,
+// поэтому синхронизация не нужна.
+type connHealth struct {
+	queries  int64
+	gucDirty bool
+	fatal    bool
+	params   map[string]string // trackedParams на момент подключения
+	pending  bool              // текущий запрос меняет GUC сессии
+}
+
+// connView — то, что политика знает о соединении; отделено от *pgx.Conn для тестов.
+type connView struct {
+	closed   bool
+	txStatus byte
+	state    *connHealth
+	param    func(string) string
+}
+
+func viewOf(conn *pgx.Conn) connView {
+	pc := conn.PgConn()
+	st, _ := pc.CustomData()[healthKey].(*connHealth)
+	return connView{closed: conn.IsClosed(), txStatus: pc.TxStatus(), state: st, param: pc.ParameterStatus}
+}
+
+// connected — AfterConnect: запоминаем исходные значения параметров.
+func (p *HealthPolicy) connected(conn *pgx.Conn) {
+	if p == nil {
+		return
+	}
+	pc := conn.PgConn()
+	st := &connHealth{params: make(map[string]string, len(trackedParams))}
+	for _, k := range trackedParams {
+		st.params[k] = pc.ParameterStatus(k)
+	}
+	pc.CustomData()[healthKey] = st
+}
+
+// healthy — BeforeAcquire и AfterRelease: false выбрасывает соединение, причина попадает в счётчики.
+// nil-политика пропускает всё.
+func (p *HealthPolicy) healthy(conn *pgx.Conn) bool {
+	if p == nil {
+		return true
+	}
+	return p.decide(conn, viewOf(conn))
+}
+
+func (p *HealthPolicy) decide(conn *pgx.Conn, v connView) bool {
+	r := p.reason(conn, v)
+	if r != "" {
+		p.count(r)
+	}
+	return r == ""
+}
+
+// reason — причина выброса или "".
+func (p *HealthPolicy) reason(conn *pgx.Conn, v connView) DiscardReason {
+	switch v.txStatus {
+	case 'T':
+		return DiscardOpenTransaction
+	case 'E':
+		return DiscardFailedTransaction
+	}
+	if v.closed {
+		return DiscardFatalError
+	}
+	if st := v.state; st != nil {
+		switch {
+		case st.fatal:
+			return DiscardFatalError
+		case st.gucDirty || paramsChanged(st.params, v.param):
+			return DiscardModifiedGUC
+		case p.MaxQueries > 0 && st.queries >= p.MaxQueries:
+			return DiscardQueryLimit
+		}
+	}
+	for _, check := range p.Checks {
+		if r := check(conn); r != "" {
+			return r
+		}
+	}
+	return ""
+}
+
+func paramsChanged(orig map[string]string, current func(string) string) bool {
+	for k, v := range orig {
+		if current(k) != v {
+			return true
+		}
+	}
+	return false
+}
+
+// TraceRelease — pgxpool.ReleaseTracer: считаем выбросы, которые pgxpool делает сам до AfterRelease.
+func (p *HealthPolicy) TraceRelease(_ *pgxpool.Pool, data pgxpool.TraceReleaseData) {
+	v := viewOf(data.Conn)
+	switch {
+	case v.txStatus == 'T':
+		p.count(DiscardOpenTransaction)
+	case v.txStatus == 'E':
+		p.count(DiscardFailedTransaction)
+	case v.closed:
+		p.count(DiscardFatalError)
+	}
+}
+
+// TraceQueryStart/TraceQueryEnd — счётчик запросов, SET/RESET и фатальные ошибки.
+func (p *HealthPolicy) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if st, ok := conn.PgConn().CustomData()[healthKey].(*connHealth); ok {
+		st.pending = changesSessionGUC(data.SQL)
+	}
+	return ctx
+}
+
+func (p *HealthPolicy) TraceQueryEnd(_ context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	if st, ok := conn.PgConn().CustomData()[healthKey].(*connHealth); ok {
+		st.observe(data.Err)
+	}
+}
+
+// TraceBatchStart/TraceBatchQuery/TraceBatchEnd — каждый элемент батча считается запросом.
+func (p *HealthPolicy) TraceBatchStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceBatchStartData) context.Context {
+	return ctx
+}
+
+func (p *HealthPolicy) TraceBatchQuery(_ context.Context, conn *pgx.Conn, data pgx.TraceBatchQueryData) {
+	if st, ok := conn.PgConn().CustomData()[healthKey].(*connHealth); ok {
+		st.pending = changesSessionGUC(data.SQL)
+		st.observe(data.Err)
+	}
+}
+
+func (p *HealthPolicy) TraceBatchEnd(context.Context, *pgx.Conn, pgx.TraceBatchEndData) {}
+
+func (st *connHealth) observe(err error) {
+	st.queries++
+	if st.pending && err == nil {
+		st.gucDirty = true
+	}
+	st.pending = false
+	if isFatal(err) {
+		st.fatal = true
+	}
+}
+
+// isFatal — ошибка, после которой соединение нельзя переиспользовать.
+func isFatal(err error) bool {
+	if err == nil {
+		return false
+	}
+	var pge *pgconn.PgError
+	if errors.As(err, &pge) {
+		return pge.Severity == "FATAL" || pge.Severity == "PANIC"
+	}
+	return errors.Is(pgerr.Classify(err), pgerr.ErrConnLost)
+}
+
+var (
+	// SET/RESET уровня сессии; SET LOCAL, SET TRANSACTION и SET CONSTRAINTS живут до конца транзакции.
+	reSessionSet = regexp.MustCompile(`(?is)^\s*(?:SET\s+(?:SESSION\s+)?(?:[a-z_."]+\s*(?:=|TO\s)|ROLE|SESSION\s+AUTHORIZATION|TIME\s+ZONE|SCHEMA|NAMES)|RESET\s)`)
+	reSetConfig  = regexp.MustCompile(`(?is)set_config\s*\([^)]*,\s*false\s*\)`)
+)
+
+// changesSessionGUC — меняет ли sql параметры сессии (по тексту; имена prepared-выражений не совпадут).
+func changesSessionGUC(sql string) bool {
+	return reSessionSet.MatchString(sql) || reSetConfig.MatchString(sql)
+}
@@ -0,0 +1,161 @@
+package pgx_demo
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// healthyView — свежее соединение в состоянии idle с исходными параметрами.
+func healthyView() connView {
+	params := map[string]string{"TimeZone": "UTC", "search_path": `"$user", public`}
+	return connView{
+		txStatus: 'I',
+		state:    &connHealth{params: map[string]string{"TimeZone": "UTC", "search_path": `"$user", public`}},
+		param:    func(k string) string { return params[k] },
+	}
+}
+
+func TestHealthPolicyReasons(t *testing.T) {
+	p := &HealthPolicy{MaxQueries: 3}
+	for _, tc := range []struct {
+		name   string
+		mutate func(*connView)
+		want   DiscardReason
+	}{
+		{"healthy", func(*connView) {}, ""},
+		{"open tx", func(v *connView) { v.txStatus = 'T' }, DiscardOpenTransaction},
+		{"failed tx", func(v *connView) { v.txStatus = 'E' }, DiscardFailedTransaction},
+		{"closed", func(v *connView) { v.closed = true }, DiscardFatalError},
+		{"fatal", func(v *connView) { v.state.fatal = true }, DiscardFatalError},
+		{"SET", func(v *connView) { v.state.gucDirty = true }, DiscardModifiedGUC},
+		{"reported param", func(v *connView) { v.param = func(string) string { return "Europe/Moscow" } }, DiscardModifiedGUC},
+		{"query limit", func(v *connView) { v.state.queries = 3 }, DiscardQueryLimit},
+		{"below limit", func(v *connView) { v.state.queries = 2 }, ""},
+		{"no state", func(v *connView) { v.state = nil }, ""},
+	} {
+		v := healthyView()
+		tc.mutate(&v)
+		if got := p.reason(nil, v); got != tc.want {
+			t.Errorf("%s: reason = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+
+	// Нулевая политика — без лимита запросов.
+	v := healthyView()
+	v.state.queries = 1 << 40
+	if got := (&HealthPolicy{}).reason(nil, v); got != "" {
+		t.Errorf("zero policy: reason = %q, want healthy", got)
+	}
+}
+
+func TestHealthPolicyChecksAndCounters(t *testing.T) {
+	const custom DiscardReason = "custom"
+	reject := false
+	p := &HealthPolicy{Checks: []ConnCheck{func(*pgx.Conn) DiscardReason {
+		if reject {
+			return custom
+		}
+		return ""
+	}}}
+
+	if !p.decide(nil, healthyView()) {
+		t.Fatal("healthy conn discarded")
+	}
+	reject = true
+	if p.decide(nil, healthyView()) {
+		t.Fatal("custom check ignored")
+	}
+	failed := healthyView()
+	failed.txStatus = 'E'
+	p.decide(nil, failed)
+	p.decide(nil, failed)
+
+	got := p.Discards()
+	if got[custom] != 1 || got[DiscardFailedTransaction] != 2 || len(got) != 2 {
+		t.Errorf("Discards() = %v", got)
+	}
+	got[custom] = 100
+	if p.Discards()[custom] != 1 {
+		t.Error("Discards() must return a copy")
+	}
+
+	var nilPolicy *HealthPolicy
+	if !nilPolicy.healthy(nil) {
+		t.Error("nil policy must keep every conn")
+	}
+}
+
+func TestHealthObserve(t *testing.T) {
+	st := &connHealth{}
+	for _, sql := range []string{"SELECT 1", "ps_get_user_by_id", "SET LOCAL statement_timeout = 0"} {
+		st.pending = changesSessionGUC(sql)
+		st.observe(nil)
+	}
+	if st.queries != 3 || st.gucDirty || st.fatal {
+		t.Fatalf("after plain queries: %+v", st)
+	}
+
+	// Неудавшийся SET сессию не меняет.
+	st.pending = changesSessionGUC("SET search_path TO nope")
+	st.observe(&pgconn.PgError{Severity: "ERROR", Code: "22023"})
+	if st.gucDirty || st.fatal {
+		t.Fatalf("failed SET: %+v", st)
+	}
+	st.pending = changesSessionGUC("SET search_path TO tenant_1")
+	st.observe(nil)
+	if !st.gucDirty {
+		t.Error("successful SET not noticed")
+	}
+
+	st = &connHealth{}
+	st.observe(io.ErrUnexpectedEOF)
+	if !st.fatal {
+		t.Error("lost connection must be fatal")
+	}
+}
+
+func TestIsFatal(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("boom"), false},
+		{&pgconn.PgError{Severity: "ERROR", Code: "23505"}, false},
+		{&pgconn.PgError{Severity: "FATAL", Code: "57P01"}, true},
+		{&pgconn.PgError{Severity: "PANIC", Code: "XX000"}, true},
+		{io.EOF, true},
+	} {
+		if got := isFatal(tc.err); got != tc.want {
+			t.Errorf("isFatal(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestChangesSessionGUC(t *testing.T) {
+	for sql, want := range map[string]bool{
+		"SET search_path TO tenant_1":                      true,
+		"set statement_timeout = '5s'":                     true,
+		"SET SESSION work_mem TO '64MB'":                   true,
+		"SET ROLE tenant_reader":                           true,
+		"SET SESSION AUTHORIZATION app":                    true,
+		"SET TIME ZONE 'UTC'":                              true,
+		"RESET ALL":                                        true,
+		"  reset search_path":                              true,
+		"SELECT set_config('search_path', 'x', false)":     true,
+		"SELECT set_config('search_path', 'x', true)":      false,
+		"SET LOCAL statement_timeout = 0":                  false,
+		"SET TRANSACTION ISOLATION LEVEL SERIALIZABLE":     false,
+		"SET CONSTRAINTS ALL DEFERRED":                     false,
+		"UPDATE app_users SET name = $1 WHERE id = $2":     false,
+		"SELECT id FROM app_users WHERE email = 'SET x=1'": false,
+	} {
+		if got := changesSessionGUC(sql); got != want {
+			t.Errorf("changesSessionGUC(%q) = %v, want %v", sql, got, want)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+// Журнал проводок (ledger_entries, см. migrations/0002_ledger.up.sql).
+// Любое изменение accounts.balance проходит через PostEntry: баланс меняется в той же транзакции,
+// в которой в журнал пишутся две строки (−amount у дебета, +amount у кредита) с общим posting_id.
+// Так GetBalance всегда можно сверить с суммой журнала (RecomputeBalance, Reconcile).
+
+package pgx_demo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/MrTeeett/pgx-v5-pool-examples/pgx_demo/pgerr"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ExternalAccount — «внешний мир» в проводке: пополнение (Debit = ExternalAccount)
+// или вывод средств (Credit = ExternalAccount). В журнале хранится как user_id IS NULL.
+const ExternalAccount int64 = 0
+
+var (
+	psLockAccounts = Statements.MustRegister("ps_lock_accounts",
+		`SELECT user_id, balance
+		   FROM accounts
+		  WHERE user_id = ANY($1)
+		  ORDER BY user_id
+		    FOR UPDATE`)
+	psDebitAccount = Statements.MustRegister("ps_debit_account",
+		`UPDATE accounts SET balance = balance - $2
+		  WHERE user_id = $1 AND balance >= $2`)
+	psCreditAccount = Statements.MustRegister("ps_credit_account",
+		`UPDATE accounts SET balance = balance + $2 WHERE user_id = $1`)
+	psInsertPosting = Statements.MustRegister("ps_insert_posting",
+		`WITH p AS (SELECT nextval('ledger_postings_seq') AS id),
+		      ins AS (
+		        INSERT INTO ledger_entries(posting_id, user_id, amount, memo)
+		        SELECT p.id, leg.user_id, leg.amount, $4
+		          FROM p, (VALUES ($1::bigint, -($3::numeric)), ($2::bigint, $3::numeric)) AS leg(user_id, amount)
+		      )
+		 SELECT id FROM p`)
+	psListEntries = Statements.MustRegister("ps_list_entries",
+		`SELECT id, posting_id, user_id, amount, memo, created_at
+		   FROM ledger_entries
+		  WHERE user_id = $1 AND id > $2
+		  ORDER BY id
+		  LIMIT $3`)
+	psLedgerBalance = Statements.MustRegister("ps_ledger_balance",
+		`SELECT COALESCE(SUM(amount), 0)::numeric(12,2) FROM ledger_entries WHERE user_id = $1`)
+	psReconcile = Statements.MustRegister("ps_reconcile",
+		`SELECT a.user_id, a.balance, COALESCE(SUM(l.amount), 0)::numeric(12,2)
+		   FROM accounts a
+		   LEFT JOIN ledger_entries l ON l.user_id = a.user_id
+		  GROUP BY a.user_id, a.balance
+		 HAVING a.balance <> COALESCE(SUM(l.amount), 0)
+		  ORDER BY a.user_id`)
+)
+
+// Posting — одна проводка: amount списывается с Debit и зачисляется на Credit.
+type Posting struct {
+	Debit  int64
+	Credit int64
+	Amount pgtype.Numeric
+	Memo   string
+}
+
+// LedgerEntry — строка журнала. UserID.Valid=false — внешний контрагент.
+type LedgerEntry struct {
+	ID        int64
+	PostingID int64
+	UserID    pgtype.Int8
+	Amount    pgtype.Numeric
+	Memo      pgtype.Text
+	CreatedAt pgtype.Timestamptz
+}
+
+// BalanceDrift — счёт, у которого хранимый баланс разошёлся с суммой журнала.
+type BalanceDrift struct {
+	UserID int64
+	Stored pgtype.Numeric
+	Ledger pgtype.Numeric
+}
+
+// PostEntry — провести Posting: заблокировать счета, изменить балансы и записать две строки журнала.
+// Списание со счёта пользователя не может увести баланс в минус (*OverdraftError).
+// Конфликты сериализации/дедлоки/потеря соединения повторяются по DefaultRetryPolicy. Возвращает posting_id.
+func PostEntry(ctx context.Context, pool *pgxpool.Pool, p Posting) (int64, error) {
+	if err := validatePosting(p); err != nil {
+		return 0, err
+	}
+	var postingID int64
+	opts := TxOptions{TxOptions: pgx.TxOptions{IsoLevel: pgx.RepeatableRead}, Retry: DefaultRetryPolicy}
+	err := WithTx(ctx, pool, opts, func(tx pgx.Tx) error {
+		var err error
+		postingID, err = postTx(ctx, tx, p)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("post %d -> %d: %w", p.Debit, p.Credit, pgerr.Classify(err))
+	}
+	return postingID, nil
+}
+
+// validatePosting — проверки, не требующие похода в БД.
+func validatePosting(p Posting) error {
+	if p.Debit == p.Credit {
+		return fmt.Errorf("%w: same account %d", ErrInvalidTransfer, p.Debit)
+	}
+	a := p.Amount
+	if !a.Valid || a.NaN || a.InfinityModifier != pgtype.Finite || a.Int == nil || a.Int.Sign() <= 0 {
+		return fmt.Errorf("%w: amount must be a positive number, got %s", ErrInvalidTransfer, numericString(a))
+	}
+	return nil
+}
+
+// postTx — тело проводки внутри уже открытой транзакции.
+// Счета пользователей блокируются одним SELECT ... ORDER BY user_id FOR UPDATE,
+// поэтому встречные проводки берут блокировки в одном порядке и не дедлочат друг друга.
+func postTx(ctx context.Context, tx pgx.Tx, p Posting) (int64, error) {
+	var ids []int64
+	for _, uid := range []int64{p.Debit, p.Credit} {
+		if uid != ExternalAccount {
+			ids = append(ids, uid)
+		}
+	}
+	rows, err := psLockAccounts.Query(ctx, tx, ids)
+	if err != nil {
+		return 0, err
+	}
+	balances := make(map[int64]pgtype.Numeric, len(ids))
+	var (
+		id  int64
+		bal pgtype.Numeric
+	)
+	if _, err := pgx.ForEachRow(rows, []any{&id, &bal}, func() error {
+		balances[id] = bal
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	for _, uid := range ids {
+		if _, ok := balances[uid]; !ok {
+			return 0, fmt.Errorf("%w: user %d", ErrAccountNotFound, uid)
+		}
+	}
+
+	if p.Debit != ExternalAccount {
+		// Проверка «хватает ли денег» делается самим UPDATE: 0 строк => овердрафт.
+		tag, err := psDebitAccount.Exec(ctx, tx, p.Debit, p.Amount)
+		if err != nil {
+			return 0, err
+		}
+		if tag.RowsAffected() == 0 {
+			return 0, &OverdraftError{UserID: p.Debit, Balance: balances[p.Debit], Amount: p.Amount}
+		}
+	}
+	if p.Credit != ExternalAccount {
+		if _, err := psCreditAccount.Exec(ctx, tx, p.Credit, p.Amount); err != nil {
+			return 0, err
+		}
+	}
+
+	memo := pgtype.Text{String: p.Memo, Valid: p.Memo != ""}
+	var postingID int64
+	err = psInsertPosting.QueryRow(ctx, tx, ledgerUserID(p.Debit), ledgerUserID(p.Credit), p.Amount, memo).Scan(&postingID)
+	return postingID, err
+}
+
+// ledgerUserID — ExternalAccount пишется в журнал как NULL.
+func ledgerUserID(uid int64) pgtype.Int8 {
+	return pgtype.Int8{Int64: uid, Valid: uid != ExternalAccount}
+}
+
+// ListEntries — строки журнала пользователя по возрастанию id, начиная после afterID (keyset-пагинация).
+func ListEntries(ctx context.Context, q Querier, userID, afterID int64, limit int) ([]LedgerEntry, error) {
+	rows, err := psListEntries.Query(ctx, q, userID, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[LedgerEntry])
+}
+
+// RecomputeBalance — баланс счёта, пересчитанный по журналу (сумма всех строк пользователя).
+// Ничего не пишет: сравните с GetBalance или используйте Reconcile для всех счетов сразу.
+func RecomputeBalance(ctx context.Context, q Querier, userID int64) (pgtype.Numeric, error) {
+	var n pgtype.Numeric
+	if err := psLedgerBalance.QueryRow(ctx, q, userID).Scan(&n); err != nil {
+		return pgtype.Numeric{}, err
+	}
+	return n, nil
+}
+
+// Reconcile — счета, чей хранимый баланс разошёлся с журналом. Пустой срез — всё сходится.
+func Reconcile(ctx context.Context, q Querier) ([]BalanceDrift, error) {
+	rows, err := psReconcile.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[BalanceDrift])
+}
+
+// Deposit — пополнение счёта извне (проводка ExternalAccount -> userID).
+func Deposit(ctx context.Context, pool *pgxpool.Pool, userID int64, amount pgtype.Numeric, memo string) (int64, error) {
+	return PostEntry(ctx, pool, Posting{Debit: ExternalAccount, Credit: userID, Amount: amount, Memo: memo})
+}
@@ -0,0 +1,45 @@
+package pgx_demo
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestValidatePosting(t *testing.T) {
+	ten := pgtype.Numeric{Int: big.NewInt(1000), Exp: -2, Valid: true}
+
+	valid := []Posting{
+		{Debit: 1, Credit: 2, Amount: ten},
+		{Debit: ExternalAccount, Credit: 2, Amount: ten}, // пополнение
+		{Debit: 1, Credit: ExternalAccount, Amount: ten}, // вывод
+	}
+	for _, p := range valid {
+		if err := validatePosting(p); err != nil {
+			t.Errorf("validatePosting(%+v) = %v", p, err)
+		}
+	}
+
+	invalid := []Posting{
+		{Debit: 1, Credit: 1, Amount: ten},
+		{Debit: ExternalAccount, Credit: ExternalAccount, Amount: ten},
+		{Debit: 1, Credit: 2},
+		{Debit: 1, Credit: 2, Amount: pgtype.Numeric{Int: big.NewInt(-1), Valid: true}},
+	}
+	for _, p := range invalid {
+		if err := validatePosting(p); !errors.Is(err, ErrInvalidTransfer) {
+			t.Errorf("validatePosting(%+v) = %v, want ErrInvalidTransfer", p, err)
+		}
+	}
+}
+
+func TestLedgerUserID(t *testing.T) {
+	if got := ledgerUserID(ExternalAccount); got.Valid {
+		t.Errorf("ledgerUserID(External) = %+v, want NULL", got)
+	}
+	if got := ledgerUserID(42); !got.Valid || got.Int64 != 42 {
+		t.Errorf("ledgerUserID(42) = %+v", got)
+	}
+}
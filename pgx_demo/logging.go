@@ -0,0 +1,210 @@
+// Структурированное логирование пула и запросов через log/slog.
+// Запросы, батчи, COPY, prepare и connect пишет pgx/tracelog, а SlogAdapter переводит его записи
+// в slog: уровни, slow-query порог, маскирование аргументов. Жизненный цикл соединений
+// (создание, выдача, возврат) логируется из хуков AfterConnect/BeforeAcquire/AfterRelease —
+// там есть само соединение, а не только факт события.
+//
+// Подключение: BuildPool(ctx, dsn, WithSlog(NewSlogAdapter(SlogOptions{Logger: logger})))
+
+package pgx_demo
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/tracelog"
+)
+
+// DefaultRedactColumns — колонки, значения параметров для которых не попадают в лог.
+var DefaultRedactColumns = []string{"email", "password", "token"}
+
+// redactedValue — то, что пишется вместо замаскированного аргумента.
+const redactedValue = "[REDACTED]"
+
+// SlogOptions — настройки SlogAdapter. Нулевое значение slog.Level — Info.
+type SlogOptions struct {
+	Logger *slog.Logger // nil — slog.Default()
+	// QueryLevel — уровень успешных запросов, батчей, COPY и prepare.
+	QueryLevel slog.Level
+	// PoolLevel — уровень событий пула: connect, acquire, release.
+	PoolLevel slog.Level
+	// SlowQueryThreshold — запросы дольше порога пишутся с уровнем Warn и slow=true. 0 — выключено.
+	SlowQueryThreshold time.Duration
+	// RedactColumns — колонки, чьи параметры маскируются. nil — DefaultRedactColumns.
+	RedactColumns []string
+}
+
+// SlogAdapter — мост pgx → slog. Ошибки всегда пишутся с уровнем Error.
+type SlogAdapter struct {
+	opts   SlogOptions
+	log    *slog.Logger
+	redact map[string]bool
+	reg    *StatementRegistry
+	trace  *tracelog.TraceLog
+
+	// redactCache — позиции маскируемых параметров по тексту SQL (разбор регулярками недешёв).
+	redactCache sync.Map // string -> map[int]bool
+}
+
+// NewSlogAdapter — адаптер с заданными настройками.
+func NewSlogAdapter(opts SlogOptions) *SlogAdapter {
+	a := &SlogAdapter{opts: opts, log: opts.Logger, reg: Statements, redact: make(map[string]bool)}
+	if a.log == nil {
+		a.log = slog.Default()
+	}
+	cols := opts.RedactColumns
+	if cols == nil {
+		cols = DefaultRedactColumns
+	}
+	for _, c := range cols {
+		a.redact[strings.ToLower(c)] = true
+	}
+	// LogLevelInfo: tracelog отдаёт запросы и ошибки, но не свои Acquire/Release (Debug) —
+	// их пишут хуки адаптера.
+	a.trace = &tracelog.TraceLog{
+		Logger:   tracelog.LoggerFunc(a.logTrace),
+		LogLevel: tracelog.LogLevelInfo,
+		Config:   &tracelog.TraceLogConfig{TimeKey: "duration"},
+	}
+	return a
+}
+
+// Tracer — трассировщик запросов для ConnConfig.Tracer (см. WithSlog).
+func (a *SlogAdapter) Tracer() pgx.QueryTracer { return a.trace }
+
+// Hooks — хуки пула, логирующие создание соединения, выдачу и возврат.
+func (a *SlogAdapter) Hooks() Hooks {
+	return Hooks{
+		AfterConnect: func(ctx context.Context, conn *pgx.Conn) error {
+			if a.log.Enabled(ctx, a.opts.PoolLevel) {
+				pc := conn.PgConn()
+				a.log.LogAttrs(ctx, a.opts.PoolLevel, "pool.connect",
+					slog.Uint64("pid", uint64(pc.PID())),
+					slog.String("host", conn.Config().Host),
+					slog.String("server_version", pc.ParameterStatus("server_version")))
+			}
+			return nil
+		},
+		BeforeAcquire: func(ctx context.Context, conn *pgx.Conn) bool {
+			if a.log.Enabled(ctx, a.opts.PoolLevel) {
+				a.log.LogAttrs(ctx, a.opts.PoolLevel, "pool.acquire", slog.Uint64("pid", uint64(conn.PgConn().PID())))
+			}
+			return true
+		},
+		AfterRelease: func(conn *pgx.Conn) bool {
+			// У AfterRelease нет контекста вызова.
+			ctx := context.Background()
+			if a.log.Enabled(ctx, a.opts.PoolLevel) {
+				a.log.LogAttrs(ctx, a.opts.PoolLevel, "pool.release",
+					slog.Uint64("pid", uint64(conn.PgConn().PID())),
+					slog.String("tx_status", string(conn.PgConn().TxStatus())))
+			}
+			return true
+		},
+	}
+}
+
+// logTrace — запись tracelog → slog.
+func (a *SlogAdapter) logTrace(ctx context.Context, lvl tracelog.LogLevel, msg string, data map[string]any) {
+	level := a.opts.QueryLevel
+	switch {
+	case lvl <= tracelog.LogLevelError:
+		level = slog.LevelError
+	case msg == "Connect":
+		level = a.opts.PoolLevel
+	}
+
+	if d, ok := data["duration"].(time.Duration); ok && a.opts.SlowQueryThreshold > 0 &&
+		d >= a.opts.SlowQueryThreshold && level < slog.LevelWarn {
+		level = slog.LevelWarn
+		data["slow"] = true
+	}
+	if !a.log.Enabled(ctx, level) {
+		return
+	}
+
+	// Имя prepared-выражения вместо SQL: показываем имя отдельно, а маскирование ведём по его SQL.
+	if sql, ok := data["sql"].(string); ok {
+		if st, found := a.reg.Lookup(sql); found {
+			data["stmt"] = st.Name()
+			sql = st.SQL()
+		}
+		if args, ok := data["args"].([]any); ok {
+			data["args"] = a.redactArgs(sql, args)
+		}
+	}
+
+	attrs := make([]slog.Attr, 0, len(data))
+	for _, k := range slices.Sorted(maps.Keys(data)) {
+		attrs = append(attrs, slog.Any(k, data[k]))
+	}
+	a.log.LogAttrs(ctx, level, "pgx."+strings.ToLower(msg), attrs...)
+}
+
+// redactArgs — копия args, где параметры маскируемых колонок заменены на redactedValue.
+func (a *SlogAdapter) redactArgs(sql string, args []any) []any {
+	var pos map[int]bool
+	if v, ok := a.redactCache.Load(sql); ok {
+		pos = v.(map[int]bool)
+	} else {
+		pos = redactedParams(sql, a.redact)
+		a.redactCache.Store(sql, pos)
+	}
+	if len(pos) == 0 {
+		return args
+	}
+	out := slices.Clone(args)
+	for i := range out {
+		if pos[i+1] {
+			out[i] = redactedValue
+		}
+	}
+	return out
+}
+
+var (
+	// col = $N, col <> $N, col LIKE $N, col = COALESCE($N, ...) — в WHERE и SET.
+	reParamCompare = regexp.MustCompile(`(?i)([a-z_][a-z0-9_.]*)\s*(?:=|<>|!=|<=|>=|<|>|\sLIKE|\sILIKE)\s*(?:COALESCE\s*\(\s*)?\$(\d+)`)
+	// INSERT INTO t(col1, col2) VALUES ($1, $2)
+	reInsertValues = regexp.MustCompile(`(?is)INSERT\s+INTO\s+[a-z0-9_."]+\s*\(([^)]*)\)\s*VALUES\s*\(([^)]*)\)`)
+	reParamRef     = regexp.MustCompile(`^\$(\d+)$`)
+)
+
+// redactedParams — номера параметров ($N), которые сопоставлены маскируемым колонкам.
+// Разбор эвристический (регулярки), но покрывает формы запросов этого пакета.
+func redactedParams(sql string, cols map[string]bool) map[int]bool {
+	pos := make(map[int]bool)
+	isRedacted := func(col string) bool {
+		col = strings.Trim(strings.TrimSpace(col), `"`)
+		if i := strings.LastIndexByte(col, '.'); i >= 0 {
+			col = col[i+1:]
+		}
+		return cols[strings.ToLower(col)]
+	}
+
+	for _, m := range reParamCompare.FindAllStringSubmatch(sql, -1) {
+		if isRedacted(m[1]) {
+			n, _ := strconv.Atoi(m[2])
+			pos[n] = true
+		}
+	}
+	for _, m := range reInsertValues.FindAllStringSubmatch(sql, -1) {
+		names, values := strings.Split(m[1], ","), strings.Split(m[2], ",")
+		for i := 0; i < len(names) && i < len(values); i++ {
+			ref := reParamRef.FindStringSubmatch(strings.TrimSpace(values[i]))
+			if ref != nil && isRedacted(names[i]) {
+				n, _ := strconv.Atoi(ref[1])
+				pos[n] = true
+			}
+		}
+	}
+	return pos
+}
@@ -0,0 +1,129 @@
+package pgx_demo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestRedactedParams(t *testing.T) {
+	cols := map[string]bool{"email": true}
+	for _, tc := range []struct {
+		stmt Stmt
+		want []int
+	}{
+		{psInsertUser, []int{1}},
+		{psGetUserByEmail, []int{1}},
+		{psUpdateUser, []int{2}},
+		{psGetBalanceByEmail, []int{1}}, // u.email = $1
+		{psGetBalance, nil},
+	} {
+		got := redactedParams(tc.stmt.SQL(), cols)
+		if len(got) != len(tc.want) {
+			t.Errorf("%s: redacted %v, want %v", tc.stmt.Name(), got, tc.want)
+			continue
+		}
+		for _, n := range tc.want {
+			if !got[n] {
+				t.Errorf("%s: $%d not redacted (got %v)", tc.stmt.Name(), n, got)
+			}
+		}
+	}
+}
+
+// logRecords — JSON-записи slog из буфера.
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var out []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var m map[string]any
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("bad log line %q: %v", line, err)
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+func TestSlogAdapterQueries(t *testing.T) {
+	var buf bytes.Buffer
+	a := NewSlogAdapter(SlogOptions{
+		Logger:             slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		QueryLevel:         slog.LevelDebug,
+		SlowQueryThreshold: time.Hour,
+	})
+	tr := a.Tracer()
+	conn := &pgx.Conn{}
+	ctx := context.Background()
+
+	qctx := tr.TraceQueryStart(ctx, conn, pgx.TraceQueryStartData{SQL: psInsertUser.Name(), Args: []any{"alice@example.com", "Alice", nil}})
+	tr.TraceQueryEnd(qctx, conn, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("INSERT 0 1")})
+	qctx = tr.TraceQueryStart(ctx, conn, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	tr.TraceQueryEnd(qctx, conn, pgx.TraceQueryEndData{Err: errors.New("boom")})
+
+	if strings.Contains(buf.String(), "alice@example.com") {
+		t.Fatalf("email leaked into log: %s", buf.String())
+	}
+	recs := logRecords(t, &buf)
+	if len(recs) != 2 {
+		t.Fatalf("got %d records, want 2", len(recs))
+	}
+	ok, failed := recs[0], recs[1]
+	if ok["msg"] != "pgx.query" || ok["level"] != "DEBUG" || ok["stmt"] != "ps_insert_user" {
+		t.Errorf("query record = %v", ok)
+	}
+	if args := ok["args"].([]any); args[0] != redactedValue || args[1] != "Alice" {
+		t.Errorf("args = %v, want email redacted", args)
+	}
+	if _, slow := ok["slow"]; slow {
+		t.Error("fast query marked slow")
+	}
+	if failed["level"] != "ERROR" || failed["err"] != "boom" {
+		t.Errorf("error record = %v", failed)
+	}
+}
+
+func TestSlogAdapterSlowQuery(t *testing.T) {
+	var buf bytes.Buffer
+	a := NewSlogAdapter(SlogOptions{
+		Logger:             slog.New(slog.NewJSONHandler(&buf, nil)), // Info и выше
+		QueryLevel:         slog.LevelDebug,
+		SlowQueryThreshold: time.Nanosecond,
+	})
+	tr := a.Tracer()
+	conn := &pgx.Conn{}
+
+	qctx := tr.TraceQueryStart(context.Background(), conn, pgx.TraceQueryStartData{SQL: "SELECT pg_sleep(1)"})
+	time.Sleep(time.Millisecond)
+	tr.TraceQueryEnd(qctx, conn, pgx.TraceQueryEndData{})
+
+	// Обычный запрос на Debug отфильтрован бы, медленный поднимается до Warn.
+	recs := logRecords(t, &buf)
+	if len(recs) != 1 || recs[0]["level"] != "WARN" || recs[0]["slow"] != true {
+		t.Fatalf("records = %v, want one slow WARN", recs)
+	}
+}
+
+func TestWithSlogInstallsTracerAndHooks(t *testing.T) {
+	cfg, err := BuildPoolConfig(testDSN, WithSlog(NewSlogAdapter(SlogOptions{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cfg.ConnConfig.Tracer.(pgx.QueryTracer); !ok {
+		t.Errorf("Tracer = %T, want a QueryTracer", cfg.ConnConfig.Tracer)
+	}
+	if cfg.BeforeAcquire == nil || cfg.AfterRelease == nil || cfg.AfterConnect == nil {
+		t.Error("pool hooks are not installed")
+	}
+}
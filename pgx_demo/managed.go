@@ -0,0 +1,238 @@
+// ManagedPool — пул с горячей перезагрузкой конфигурации.
+// BuildPool собирает пул один раз: чтобы поменять MaxConns или MaxConnLifetime, приходилось
+// перезапускать процесс. ManagedPool следит за источником DSN (файл или функция) и при изменении:
+//  1. собирает новый пул через BuildPool;
+//  2. атомарно подменяет его — новые вызовы Pool() получают новый пул;
+//  3. старый пул закрывается в фоне: pgxpool.Close ждёт возврата всех выданных соединений,
+//     так что начатые транзакции доживают до COMMIT/ROLLBACK на старом пуле;
+//  4. сообщает о подмене и о завершении дренажа через OnEvent.
+//
+// Лимиты и времена жизни задаются параметрами pool_* в DSN (pool_max_conns, pool_max_conn_lifetime, ...):
+// опции из ManagedOptions.PoolOptions имеют приоритет над DSN и перезагрузкой не меняются.
+//
+//	m, _ := NewManagedPool(ctx, FileSource("/etc/app/pg.dsn"), ManagedOptions{})
+//	go m.Watch(ctx, 10*time.Second)
+//	bal, _ := GetBalance(ctx, m.Pool(), id)
+//	conn, _ := m.Acquire(ctx) // соединение, переживающее подмену
+
+package pgx_demo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ConfigSource — текущий DSN пула (вместе с pool_* параметрами).
+type ConfigSource func(ctx context.Context) (string, error)
+
+// FileSource — DSN из файла (пробелы и переводы строк по краям отбрасываются).
+func FileSource(path string) ConfigSource {
+	return func(context.Context) (string, error) {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+}
+
+// ErrManagedPoolClosed — Reload после Close.
+var ErrManagedPoolClosed = errors.New("managed pool closed")
+
+// ManagedEventKind — что произошло с пулом.
+type ManagedEventKind string
+
+const (
+	// PoolSwapped — новый пул подменил старый.
+	PoolSwapped ManagedEventKind = "swapped"
+	// PoolDrained — старый пул закрыт, все его соединения возвращены.
+	PoolDrained ManagedEventKind = "drained"
+	// PoolReloadFailed — новая конфигурация не применена, работает прежний пул.
+	PoolReloadFailed ManagedEventKind = "reload_failed"
+)
+
+// ManagedEvent — событие ManagedPool.
+type ManagedEvent struct {
+	Kind ManagedEventKind
+	// Changes — изменённые настройки пула ("MaxConns: 10 -> 20"); для PoolSwapped.
+	Changes []string
+	// Drain — сколько закрывался старый пул; для PoolDrained.
+	Drain time.Duration
+	Err   error
+	At    time.Time
+}
+
+// ManagedOptions — настройки ManagedPool.
+type ManagedOptions struct {
+	// PoolOptions — опции BuildPool для каждого нового пула (метрики, хуки, трассировка, ...).
+	PoolOptions []PoolOption
+	// DrainGrace — пауза перед закрытием старого пула: вызывающие, взявшие Pool() перед подменой,
+	// успевают сделать Acquire. По умолчанию 1s.
+	DrainGrace time.Duration
+	// OnEvent — подмена, дренаж и ошибки перезагрузки.
+	OnEvent func(ManagedEvent)
+}
+
+const defaultDrainGrace = time.Second
+
+// ManagedPool — текущий *pgxpool.Pool и механизм его подмены.
+type ManagedPool struct {
+	src  ConfigSource
+	opts ManagedOptions
+	cur  atomic.Pointer[pgxpool.Pool]
+
+	mu     sync.Mutex // сериализует Reload/Close
+	dsn    string
+	closed bool
+	drains sync.WaitGroup
+}
+
+// NewManagedPool — пул по текущему DSN из src.
+func NewManagedPool(ctx context.Context, src ConfigSource, opts ManagedOptions) (*ManagedPool, error) {
+	if opts.DrainGrace <= 0 {
+		opts.DrainGrace = defaultDrainGrace
+	}
+	dsn, err := src(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("config source: %w", err)
+	}
+	pool, err := BuildPool(ctx, dsn, opts.PoolOptions...)
+	if err != nil {
+		return nil, err
+	}
+	m := &ManagedPool{src: src, opts: opts, dsn: dsn}
+	m.cur.Store(pool)
+	return m, nil
+}
+
+// Pool — текущий пул. Контракт: берите его на каждую операцию и не храните дольше DrainGrace —
+// через DrainGrace после подмены старый пул закрывается и его Acquire/Query возвращают ошибку
+// закрытого пула. Уже выданные им соединения при этом доживают до Release.
+func (m *ManagedPool) Pool() *pgxpool.Pool { return m.cur.Load() }
+
+// Acquire — соединение из текущего пула. Если пул успели подменить и закрыть между Pool()
+// и Acquire, один раз повторяет на новом пуле.
+func (m *ManagedPool) Acquire(ctx context.Context) (*pgxpool.Conn, error) {
+	return m.acquireFrom(ctx, m.Pool())
+}
+
+func (m *ManagedPool) acquireFrom(ctx context.Context, pool *pgxpool.Pool) (*pgxpool.Conn, error) {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		if next := m.Pool(); next != pool {
+			return next.Acquire(ctx)
+		}
+	}
+	return conn, err
+}
+
+// Reload — перечитать источник; если DSN изменился, собрать новый пул и подменить им текущий.
+// При ошибке текущий пул остаётся в работе. swapped — была ли подмена.
+func (m *ManagedPool) Reload(ctx context.Context) (swapped bool, err error) {
+	defer func() {
+		if err != nil && !errors.Is(err, ErrManagedPoolClosed) {
+			m.emit(ManagedEvent{Kind: PoolReloadFailed, Err: err})
+		}
+	}()
+	dsn, err := m.src(ctx)
+	if err != nil {
+		return false, fmt.Errorf("config source: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return false, ErrManagedPoolClosed
+	}
+	if dsn == m.dsn {
+		return false, nil
+	}
+	next, err := BuildPool(ctx, dsn, m.opts.PoolOptions...)
+	if err != nil {
+		return false, err
+	}
+	prev := m.cur.Swap(next)
+	m.dsn = dsn
+	m.emit(ManagedEvent{Kind: PoolSwapped, Changes: poolConfigChanges(prev.Config(), next.Config())})
+	m.drain(prev)
+	return true, nil
+}
+
+// Watch — Reload раз в interval, пока не отменён ctx. Ошибки уходят в OnEvent (PoolReloadFailed).
+func (m *ManagedPool) Watch(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if _, err := m.Reload(ctx); errors.Is(err, ErrManagedPoolClosed) {
+				return
+			}
+		}
+	}
+}
+
+// drain — закрыть старый пул в фоне после DrainGrace.
+func (m *ManagedPool) drain(prev *pgxpool.Pool) {
+	m.drains.Add(1)
+	go func() {
+		defer m.drains.Done()
+		time.Sleep(m.opts.DrainGrace)
+		start := time.Now()
+		prev.Close() // ждёт возврата выданных соединений
+		m.emit(ManagedEvent{Kind: PoolDrained, Drain: time.Since(start)})
+	}()
+}
+
+// Close — закрыть текущий пул и дождаться дренажа предыдущих.
+func (m *ManagedPool) Close() {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return
+	}
+	m.closed = true
+	m.mu.Unlock()
+	m.cur.Load().Close()
+	m.drains.Wait()
+}
+
+func (m *ManagedPool) emit(e ManagedEvent) {
+	if m.opts.OnEvent == nil {
+		return
+	}
+	e.At = time.Now()
+	m.opts.OnEvent(e)
+}
+
+// poolConfigChanges — различия в настройках пула и адресе базы (пароль не сравнивается и не выводится).
+func poolConfigChanges(a, b *pgxpool.Config) []string {
+	var out []string
+	diff := func(name string, x, y any) {
+		if x != y {
+			out = append(out, fmt.Sprintf("%s: %v -> %v", name, x, y))
+		}
+	}
+	diff("Host", a.ConnConfig.Host, b.ConnConfig.Host)
+	diff("Port", a.ConnConfig.Port, b.ConnConfig.Port)
+	diff("Database", a.ConnConfig.Database, b.ConnConfig.Database)
+	diff("User", a.ConnConfig.User, b.ConnConfig.User)
+	diff("MaxConns", a.MaxConns, b.MaxConns)
+	diff("MinConns", a.MinConns, b.MinConns)
+	diff("MinIdleConns", a.MinIdleConns, b.MinIdleConns)
+	diff("MaxConnLifetime", a.MaxConnLifetime, b.MaxConnLifetime)
+	diff("MaxConnLifetimeJitter", a.MaxConnLifetimeJitter, b.MaxConnLifetimeJitter)
+	diff("MaxConnIdleTime", a.MaxConnIdleTime, b.MaxConnIdleTime)
+	diff("HealthCheckPeriod", a.HealthCheckPeriod, b.HealthCheckPeriod)
+	return out
+}
@@ -0,0 +1,124 @@
+package pgx_demo
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pg.dsn")
+	if err := os.WriteFile(path, []byte("  postgres://u:p@db/app?pool_max_conns=4\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	dsn, err := FileSource(path)(context.Background())
+	if err != nil || dsn != "postgres://u:p@db/app?pool_max_conns=4" {
+		t.Fatalf("FileSource = %q, %v", dsn, err)
+	}
+	if _, err := FileSource(filepath.Join(t.TempDir(), "missing"))(context.Background()); err == nil {
+		t.Error("missing file must fail")
+	}
+}
+
+func TestManagedPoolReload(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		dsn    = "postgres://u:p@localhost/app?pool_max_conns=4"
+		events = make(chan ManagedEvent, 10)
+	)
+	src := func(context.Context) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return dsn, nil
+	}
+	ctx := context.Background()
+	m, err := NewManagedPool(ctx, src, ManagedOptions{
+		PoolOptions: []PoolOption{WithMinConns(0), WithMinIdleConns(0)},
+		DrainGrace:  time.Millisecond,
+		OnEvent:     func(e ManagedEvent) { events <- e },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	old := m.Pool()
+
+	// DSN не менялся — подмены нет.
+	if swapped, err := m.Reload(ctx); swapped || err != nil {
+		t.Fatalf("Reload without changes: swapped=%v err=%v", swapped, err)
+	}
+
+	// Новые лимиты в DSN — новый пул, старый дренируется.
+	mu.Lock()
+	dsn = "postgres://u:p@localhost/app?pool_max_conns=8&pool_max_conn_lifetime=10m"
+	mu.Unlock()
+	if swapped, err := m.Reload(ctx); !swapped || err != nil {
+		t.Fatalf("Reload: swapped=%v err=%v", swapped, err)
+	}
+	if m.Pool() == old || m.Pool().Config().MaxConns != 8 {
+		t.Fatalf("new pool not in place: MaxConns=%d", m.Pool().Config().MaxConns)
+	}
+	e := <-events
+	got := strings.Join(e.Changes, "; ")
+	if e.Kind != PoolSwapped || !strings.Contains(got, "MaxConns: 4 -> 8") || !strings.Contains(got, "MaxConnLifetime: 30m0s -> 10m0s") {
+		t.Fatalf("swap event = %+v", e)
+	}
+	select {
+	case e := <-events:
+		if e.Kind != PoolDrained {
+			t.Fatalf("event = %+v, want drained", e)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("old pool was not drained")
+	}
+	if err := old.Ping(ctx); err == nil || !strings.Contains(err.Error(), "closed pool") {
+		t.Errorf("old pool Ping = %v, want closed pool", err)
+	}
+
+	// Битый DSN — прежний пул остаётся.
+	cur := m.Pool()
+	mu.Lock()
+	dsn = "postgres://u:p@localhost/app?pool_max_conns=oops"
+	mu.Unlock()
+	if swapped, err := m.Reload(ctx); swapped || err == nil {
+		t.Fatalf("bad DSN: swapped=%v err=%v", swapped, err)
+	}
+	if e := <-events; e.Kind != PoolReloadFailed || e.Err == nil {
+		t.Fatalf("event = %+v, want reload_failed", e)
+	}
+	if m.Pool() != cur {
+		t.Error("failed reload replaced the pool")
+	}
+
+	m.Close()
+	if _, err := m.Reload(ctx); !errors.Is(err, ErrManagedPoolClosed) {
+		t.Errorf("Reload after Close = %v", err)
+	}
+}
+
+func TestManagedPoolAcquireRetriesAfterSwap(t *testing.T) {
+	ctx := context.Background()
+	stale := lazyPool(t)
+	stale.Close()
+	current := lazyPool(t)
+	m := &ManagedPool{}
+
+	// Пул не подменялся — ошибка закрытого пула возвращается как есть.
+	m.cur.Store(stale)
+	if _, err := m.acquireFrom(ctx, stale); err == nil || !strings.Contains(err.Error(), "closed pool") {
+		t.Fatalf("acquire from closed current pool = %v, want closed pool", err)
+	}
+
+	// Пул подменили после Pool(): повтор на новом пуле (базы нет — ошибка подключения, но не «closed pool»).
+	m.cur.Store(current)
+	cctx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	if _, err := m.acquireFrom(cctx, stale); err == nil || strings.Contains(err.Error(), "closed pool") {
+		t.Fatalf("acquire after swap = %v, want retry on the new pool", err)
+	}
+}
@@ -0,0 +1,249 @@
+// Метрики пула: периодические снимки pool.Stat() и экспорт в текстовом формате Prometheus.
+// Помимо «сырых» счётчиков pgxpool считаем производные показатели, по которым видно,
+// что MaxConns мал: насыщение (acquired / max), доля Acquire с ожиданием и p99 ожидания Acquire.
+//
+// Подключение:
+//
+//	m := NewPoolMetrics("main")
+//	pool, _ := BuildPool(ctx, dsn, WithMetrics(m))
+//	go m.Run(ctx, pool, 10*time.Second)
+//	http.Handle("/metrics", m)
+
+package pgx_demo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// acquireWaitWindow — сколько последних Acquire учитывается в p99 ожидания.
+const acquireWaitWindow = 1024
+
+// PoolSnapshot — снимок pool.Stat() и производные показатели на момент At.
+type PoolSnapshot struct {
+	At time.Time
+
+	AcquiredConns     int32
+	IdleConns         int32
+	ConstructingConns int32
+	TotalConns        int32
+	MaxConns          int32
+
+	AcquireCount            int64
+	EmptyAcquireCount       int64 // Acquire, которым пришлось ждать/создавать соединение
+	CanceledAcquireCount    int64
+	NewConnsCount           int64
+	MaxLifetimeDestroyCount int64
+	MaxIdleDestroyCount     int64
+	AcquireDuration         time.Duration // суммарно по всем Acquire
+	EmptyAcquireWaitTime    time.Duration
+
+	// Saturation — AcquiredConns / MaxConns: 1.0 означает, что все соединения заняты.
+	Saturation float64
+	// EmptyAcquireRatio — доля Acquire с ожиданием с момента предыдущего снимка.
+	EmptyAcquireRatio float64
+	// AcquireWaitP99 — p99 длительности Acquire по последним acquireWaitWindow вызовам.
+	AcquireWaitP99 time.Duration
+}
+
+// snapshotFromStat — перенос значений pgxpool.Stat в PoolSnapshot (без производных).
+func snapshotFromStat(s *pgxpool.Stat) PoolSnapshot {
+	return PoolSnapshot{
+		At:                      time.Now(),
+		AcquiredConns:           s.AcquiredConns(),
+		IdleConns:               s.IdleConns(),
+		ConstructingConns:       s.ConstructingConns(),
+		TotalConns:              s.TotalConns(),
+		MaxConns:                s.MaxConns(),
+		AcquireCount:            s.AcquireCount(),
+		EmptyAcquireCount:       s.EmptyAcquireCount(),
+		CanceledAcquireCount:    s.CanceledAcquireCount(),
+		NewConnsCount:           s.NewConnsCount(),
+		MaxLifetimeDestroyCount: s.MaxLifetimeDestroyCount(),
+		MaxIdleDestroyCount:     s.MaxIdleDestroyCount(),
+		AcquireDuration:         s.AcquireDuration(),
+		EmptyAcquireWaitTime:    s.EmptyAcquireWaitTime(),
+	}
+}
+
+// PoolMetrics — сборщик метрик одного пула. Реализует pgxpool.AcquireTracer (через WithMetrics)
+// и http.Handler (отдаёт последний снимок). Безопасен для конкурентного использования.
+type PoolMetrics struct {
+	name string
+
+	mu    sync.Mutex
+	waits []time.Duration // кольцевой буфер длительностей Acquire
+	next  int
+	last  PoolSnapshot
+
+	breaker *CircuitBreaker // см. TrackBreaker
+}
+
+// NewPoolMetrics — сборщик; name попадает в метку pool="..." (удобно, когда пулов несколько).
+func NewPoolMetrics(name string) *PoolMetrics {
+	return &PoolMetrics{name: name, waits: make([]time.Duration, 0, acquireWaitWindow)}
+}
+
+type acquireStartKey struct{}
+
+// TraceAcquireStart — запоминаем начало Acquire в контексте.
+func (m *PoolMetrics) TraceAcquireStart(ctx context.Context, _ *pgxpool.Pool, _ pgxpool.TraceAcquireStartData) context.Context {
+	return context.WithValue(ctx, acquireStartKey{}, time.Now())
+}
+
+// TraceAcquireEnd — длительность Acquire (включая ожидание свободного соединения и BeforeAcquire).
+func (m *PoolMetrics) TraceAcquireEnd(ctx context.Context, _ *pgxpool.Pool, _ pgxpool.TraceAcquireEndData) {
+	if start, ok := ctx.Value(acquireStartKey{}).(time.Time); ok {
+		m.recordWait(time.Since(start))
+	}
+}
+
+func (m *PoolMetrics) recordWait(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.waits) < acquireWaitWindow {
+		m.waits = append(m.waits, d)
+		return
+	}
+	m.waits[m.next] = d
+	m.next = (m.next + 1) % acquireWaitWindow
+}
+
+// Collect — снять pool.Stat() прямо сейчас, посчитать производные и сохранить как последний снимок.
+func (m *PoolMetrics) Collect(pool *pgxpool.Pool) PoolSnapshot {
+	return m.observe(snapshotFromStat(pool.Stat()))
+}
+
+// Run — Collect раз в interval, пока не отменён ctx.
+func (m *PoolMetrics) Run(ctx context.Context, pool *pgxpool.Pool, interval time.Duration) {
+	m.Collect(pool)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			m.Collect(pool)
+		}
+	}
+}
+
+// TrackBreaker — добавить в вывод состояние и счётчики circuit breaker этого пула.
+func (m *PoolMetrics) TrackBreaker(b *CircuitBreaker) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.breaker = b
+}
+
+// Snapshot — последний собранный снимок.
+func (m *PoolMetrics) Snapshot() PoolSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.last
+}
+
+// observe — дополняет s производными показателями и делает его последним снимком.
+func (m *PoolMetrics) observe(s PoolSnapshot) PoolSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s.MaxConns > 0 {
+		s.Saturation = float64(s.AcquiredConns) / float64(s.MaxConns)
+	}
+	if d := s.AcquireCount - m.last.AcquireCount; d > 0 {
+		s.EmptyAcquireRatio = float64(s.EmptyAcquireCount-m.last.EmptyAcquireCount) / float64(d)
+	}
+	s.AcquireWaitP99 = percentile(m.waits, 0.99)
+
+	m.last = s
+	return s
+}
+
+// percentile — p-квантиль (nearest-rank) без изменения исходного среза.
+func percentile(ds []time.Duration, p float64) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(ds)
+	slices.Sort(sorted)
+	idx := int(float64(len(sorted))*p+0.5) - 1
+	return sorted[max(0, min(idx, len(sorted)-1))]
+}
+
+// ServeHTTP — последний снимок в текстовом формате Prometheus (text/plain; version=0.0.4).
+func (m *PoolMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo — тот же вывод, что у ServeHTTP, в произвольный io.Writer.
+func (m *PoolMetrics) WriteTo(w io.Writer) (int64, error) {
+	s := m.Snapshot()
+	cw := &countingWriter{w: w}
+	label := `{pool="` + escapeLabelValue(m.name) + `"}`
+	metric := func(name, typ, help string, v any) {
+		fmt.Fprintf(cw, "# HELP %s %s\n# TYPE %s %s\n%s%s %v\n", name, help, name, typ, name, label, v)
+	}
+
+	metric("pgxpool_acquired_conns", "gauge", "Connections currently acquired.", s.AcquiredConns)
+	metric("pgxpool_idle_conns", "gauge", "Idle connections in the pool.", s.IdleConns)
+	metric("pgxpool_constructing_conns", "gauge", "Connections being established.", s.ConstructingConns)
+	metric("pgxpool_total_conns", "gauge", "All connections in the pool.", s.TotalConns)
+	metric("pgxpool_max_conns", "gauge", "Configured MaxConns.", s.MaxConns)
+	metric("pgxpool_acquire_total", "counter", "Successful acquires.", s.AcquireCount)
+	metric("pgxpool_empty_acquire_total", "counter", "Acquires that had to wait for a connection.", s.EmptyAcquireCount)
+	metric("pgxpool_canceled_acquire_total", "counter", "Acquires canceled by context.", s.CanceledAcquireCount)
+	metric("pgxpool_new_conns_total", "counter", "Connections opened.", s.NewConnsCount)
+	metric("pgxpool_max_lifetime_destroy_total", "counter", "Connections closed by MaxConnLifetime.", s.MaxLifetimeDestroyCount)
+	metric("pgxpool_max_idle_destroy_total", "counter", "Connections closed by MaxConnIdleTime.", s.MaxIdleDestroyCount)
+	metric("pgxpool_acquire_duration_seconds_total", "counter", "Total time spent in acquire.", s.AcquireDuration.Seconds())
+	metric("pgxpool_empty_acquire_wait_seconds_total", "counter", "Total time acquires waited for a connection.", s.EmptyAcquireWaitTime.Seconds())
+	metric("pgxpool_saturation_ratio", "gauge", "Acquired connections divided by MaxConns.", s.Saturation)
+	metric("pgxpool_empty_acquire_ratio", "gauge", "Share of acquires that waited since the previous snapshot.", s.EmptyAcquireRatio)
+	metric("pgxpool_acquire_wait_p99_seconds", "gauge", "99th percentile of recent acquire durations.", s.AcquireWaitP99.Seconds())
+
+	m.mu.Lock()
+	b := m.breaker
+	m.mu.Unlock()
+	if b != nil {
+		bs := b.Stats()
+		metric("pgxpool_breaker_state", "gauge", "Circuit breaker state: 0 closed, 1 open, 2 half-open.", int(bs.State))
+		metric("pgxpool_breaker_consecutive_failures", "gauge", "Connection errors in a row.", bs.ConsecutiveFailures)
+		metric("pgxpool_breaker_trips_total", "counter", "Times the circuit breaker opened.", bs.Trips)
+		metric("pgxpool_breaker_rejected_total", "counter", "Connects and calls rejected by the open breaker.", bs.Rejected)
+	}
+	return cw.n, cw.err
+}
+
+// labelEscaper — экранирование значения метки по текстовому формату Prometheus: только '\', '"' и
+// перевод строки. %q не подходит: он экранирует и другое (\t, непечатаемые символы, невалидный UTF-8
+// как \x..), а Prometheus таких последовательностей не раскрывает — имя пула в метке искажается.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(v string) string { return labelEscaper.Replace(v) }
+
+// countingWriter — считает записанные байты и запоминает первую ошибку.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
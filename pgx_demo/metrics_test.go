@@ -0,0 +1,97 @@
+package pgx_demo
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestPoolMetricsDerived(t *testing.T) {
+	m := NewPoolMetrics("main")
+	for i := 1; i <= 100; i++ {
+		m.recordWait(time.Duration(i) * time.Millisecond)
+	}
+
+	m.observe(PoolSnapshot{MaxConns: 10, AcquireCount: 100, EmptyAcquireCount: 10})
+	s := m.observe(PoolSnapshot{MaxConns: 10, AcquiredConns: 8, AcquireCount: 150, EmptyAcquireCount: 35})
+
+	if s.Saturation != 0.8 {
+		t.Errorf("Saturation = %v, want 0.8", s.Saturation)
+	}
+	// С прошлого снимка: 50 Acquire, из них 25 ждали.
+	if s.EmptyAcquireRatio != 0.5 {
+		t.Errorf("EmptyAcquireRatio = %v, want 0.5", s.EmptyAcquireRatio)
+	}
+	if s.AcquireWaitP99 != 99*time.Millisecond {
+		t.Errorf("AcquireWaitP99 = %s, want 99ms", s.AcquireWaitP99)
+	}
+}
+
+func TestPoolMetricsWaitWindow(t *testing.T) {
+	m := NewPoolMetrics("main")
+	for i := 0; i < acquireWaitWindow; i++ {
+		m.recordWait(time.Second)
+	}
+	// Старые значения вытесняются: после полного круга остаются только новые.
+	for i := 0; i < acquireWaitWindow; i++ {
+		m.recordWait(time.Millisecond)
+	}
+	if len(m.waits) != acquireWaitWindow {
+		t.Fatalf("window size = %d, want %d", len(m.waits), acquireWaitWindow)
+	}
+	if p := m.observe(PoolSnapshot{}).AcquireWaitP99; p != time.Millisecond {
+		t.Errorf("p99 = %s, want 1ms", p)
+	}
+}
+
+func TestPoolMetricsServeHTTP(t *testing.T) {
+	m := NewPoolMetrics("main")
+	m.observe(PoolSnapshot{MaxConns: 10, AcquiredConns: 5, AcquireCount: 7})
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE pgxpool_acquired_conns gauge\n",
+		`pgxpool_acquired_conns{pool="main"} 5` + "\n",
+		"# TYPE pgxpool_acquire_total counter\n",
+		`pgxpool_acquire_total{pool="main"} 7` + "\n",
+		`pgxpool_saturation_ratio{pool="main"} 0.5` + "\n",
+		`pgxpool_acquire_wait_p99_seconds{pool="main"} 0` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics output lacks %q", want)
+		}
+	}
+}
+
+func TestPoolMetricsLabelEscaping(t *testing.T) {
+	m := NewPoolMetrics("отчёты \"eu\"\tшард\\1\nb")
+	var out strings.Builder
+	if _, err := m.WriteTo(&out); err != nil {
+		t.Fatal(err)
+	}
+	// Экранируются только '\', '"' и перевод строки; не-ASCII и табуляция — как есть.
+	want := `pgxpool_total_conns{pool="отчёты \"eu\"` + "\t" + `шард\\1\nb"} 0` + "\n"
+	if !strings.Contains(out.String(), want) {
+		t.Errorf("metrics output lacks %q:\n%s", want, out.String())
+	}
+}
+
+func TestWithMetricsInstallsAcquireTracer(t *testing.T) {
+	m := NewPoolMetrics("main")
+	cfg, err := BuildPoolConfig(testDSN, WithMetrics(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cfg.ConnConfig.Tracer.(pgxpool.AcquireTracer); !ok {
+		t.Fatalf("ConnConfig.Tracer = %T, want a pgxpool.AcquireTracer", cfg.ConnConfig.Tracer)
+	}
+}
@@ -0,0 +1,251 @@
+// Версионные миграции схемы: .sql-файлы встраиваются в бинарник через embed.FS,
+// применённые версии хранятся в schema_migrations вместе с контрольной суммой,
+// а параллельные запуски (несколько инстансов сервиса) сериализуются advisory-lock'ом.
+
+package pgx_demo
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migrations — миграции этого пакета. Используются и bootstrap-путём, и пулом (см. EnsureSchema).
+var Migrations = mustMigrator(migrationFiles, "migrations")
+
+// migrationLockKey — ключ pg_advisory_lock, общий для всех раннеров миграций этого пакета.
+const migrationLockKey int64 = 0x7067785f6d6967 // "pgx_mig"
+
+var (
+	// ErrMigrationChecksum — файл уже применённой миграции изменён после применения.
+	ErrMigrationChecksum = errors.New("migration checksum mismatch")
+	// ErrMigrationUnknown — в schema_migrations есть версия, которой нет среди файлов.
+	ErrMigrationUnknown = errors.New("unknown applied migration")
+	// ErrMigrationNoDown — для отката нет down-файла.
+	ErrMigrationNoDown = errors.New("migration has no down script")
+)
+
+// Migration — одна версия схемы: up/down SQL и контрольная сумма up-скрипта.
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// Migrator — упорядоченный по версии набор миграций.
+type Migrator struct {
+	migrations []Migration
+}
+
+// migrationFileRe — формат имени файла: 0001_init.up.sql / 0001_init.down.sql.
+var migrationFileRe = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// NewMigrator читает миграции из каталога dir файловой системы fsys.
+func NewMigrator(fsys fs.FS, dir string) (*Migrator, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		m := migrationFileRe.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("bad migration file name %q", e.Name())
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad migration version %q: %w", e.Name(), err)
+		}
+		body, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read migration %s: %w", e.Name(), err)
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	out := &Migrator{}
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", mig.Version, mig.Name)
+		}
+		sum := sha256.Sum256([]byte(mig.Up))
+		mig.Checksum = hex.EncodeToString(sum[:])
+		out.migrations = append(out.migrations, *mig)
+	}
+	sort.Slice(out.migrations, func(i, j int) bool { return out.migrations[i].Version < out.migrations[j].Version })
+	return out, nil
+}
+
+func mustMigrator(fsys fs.FS, dir string) *Migrator {
+	m, err := NewMigrator(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// Migrations — копия списка миграций в порядке версий.
+func (m *Migrator) Migrations() []Migration {
+	return append([]Migration(nil), m.migrations...)
+}
+
+// appliedMigration — строка из schema_migrations.
+type appliedMigration struct {
+	Version  int64
+	Checksum string
+}
+
+// Up применяет все ещё не применённые миграции. Каждая — в своей транзакции вместе с записью в schema_migrations.
+// Перед этим проверяются контрольные суммы уже применённых версий.
+func (m *Migrator) Up(ctx context.Context, conn *pgx.Conn) error {
+	return m.locked(ctx, conn, func(applied map[int64]appliedMigration) error {
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, mig.Up); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx,
+					`INSERT INTO schema_migrations(version, name, checksum) VALUES ($1, $2, $3)`,
+					mig.Version, mig.Name, mig.Checksum)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s up: %w", mig.Version, mig.Name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Down откатывает steps последних применённых миграций (в обратном порядке).
+func (m *Migrator) Down(ctx context.Context, conn *pgx.Conn, steps int) error {
+	return m.locked(ctx, conn, func(applied map[int64]appliedMigration) error {
+		for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("%w: %d_%s", ErrMigrationNoDown, mig.Version, mig.Name)
+			}
+			err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, mig.Down); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx, `DELETE FROM schema_migrations WHERE version = $1`, mig.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s down: %w", mig.Version, mig.Name, err)
+			}
+			steps--
+		}
+		return nil
+	})
+}
+
+// locked — общий каркас Up/Down: advisory-lock на сессию, таблица schema_migrations, проверка checksum.
+// Lock сессионный, поэтому работаем строго на одном соединении (не на пуле).
+func (m *Migrator) locked(ctx context.Context, conn *pgx.Conn, fn func(map[int64]appliedMigration) error) (err error) {
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+		return fmt.Errorf("migration lock: %w", err)
+	}
+	defer func() {
+		// Unlock — на отдельном контексте: исходный мог уже истечь, а lock надо отпустить.
+		if _, uerr := conn.Exec(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, migrationLockKey); uerr != nil && err == nil {
+			err = fmt.Errorf("migration unlock: %w", uerr)
+		}
+	}()
+
+	if _, err := conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    BIGINT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		checksum   TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	rows, err := conn.Query(ctx, `SELECT version, checksum FROM schema_migrations`)
+	if err != nil {
+		return fmt.Errorf("read schema_migrations: %w", err)
+	}
+	list, err := pgx.CollectRows(rows, pgx.RowToStructByPos[appliedMigration])
+	if err != nil {
+		return fmt.Errorf("read schema_migrations: %w", err)
+	}
+	applied := make(map[int64]appliedMigration, len(list))
+	for _, a := range list {
+		applied[a.Version] = a
+	}
+	if err := m.verify(applied); err != nil {
+		return err
+	}
+	return fn(applied)
+}
+
+// verify — применённые версии должны существовать среди файлов и иметь ту же контрольную сумму.
+func (m *Migrator) verify(applied map[int64]appliedMigration) error {
+	known := make(map[int64]Migration, len(m.migrations))
+	for _, mig := range m.migrations {
+		known[mig.Version] = mig
+	}
+	var errs []error
+	for v, a := range applied {
+		mig, ok := known[v]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%w: version %d", ErrMigrationUnknown, v))
+			continue
+		}
+		if mig.Checksum != a.Checksum {
+			errs = append(errs, fmt.Errorf("%w: %d_%s (db=%s file=%s)", ErrMigrationChecksum, v, mig.Name, a.Checksum, mig.Checksum))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// MigratePool — Up на соединении, взятом из пула.
+func (m *Migrator) MigratePool(ctx context.Context, pool *pgxpool.Pool) error {
+	c, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Release()
+	return m.Up(ctx, c.Conn())
+}
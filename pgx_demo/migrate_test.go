@@ -0,0 +1,70 @@
+package pgx_demo
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+)
+
+func TestNewMigratorOrdersAndChecksums(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/0002_second.up.sql":   {Data: []byte("CREATE TABLE b ();")},
+		"m/0001_first.up.sql":    {Data: []byte("CREATE TABLE a ();")},
+		"m/0001_first.down.sql":  {Data: []byte("DROP TABLE a;")},
+		"m/0010_tenth.up.sql":    {Data: []byte("CREATE TABLE c ();")},
+		"m/0010_tenth.down.sql":  {Data: []byte("DROP TABLE c;")},
+		"m/0002_second.down.sql": {Data: []byte("DROP TABLE b;")},
+	}
+	m, err := NewMigrator(fsys, "m")
+	if err != nil {
+		t.Fatalf("NewMigrator: %v", err)
+	}
+	migs := m.Migrations()
+	if len(migs) != 3 || migs[0].Version != 1 || migs[1].Version != 2 || migs[2].Version != 10 {
+		t.Fatalf("migrations = %+v, want versions 1,2,10", migs)
+	}
+	if migs[0].Name != "first" || migs[0].Down != "DROP TABLE a;" {
+		t.Errorf("first = %+v", migs[0])
+	}
+	if migs[0].Checksum == "" || migs[0].Checksum == migs[1].Checksum {
+		t.Errorf("checksums = %q, %q", migs[0].Checksum, migs[1].Checksum)
+	}
+}
+
+func TestNewMigratorRejectsBadSets(t *testing.T) {
+	cases := map[string]fstest.MapFS{
+		"bad name":       {"m/init.sql": {Data: []byte("SELECT 1")}},
+		"no up":          {"m/0001_a.down.sql": {Data: []byte("SELECT 1")}},
+		"name conflict":  {"m/0001_a.up.sql": {Data: []byte("SELECT 1")}, "m/0001_b.down.sql": {Data: []byte("SELECT 1")}},
+		"missing folder": {},
+	}
+	for name, fsys := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewMigrator(fsys, "m"); err == nil {
+				t.Fatal("NewMigrator: want error")
+			}
+		})
+	}
+}
+
+func TestMigratorVerify(t *testing.T) {
+	migs := Migrations.Migrations()
+	if len(migs) == 0 || migs[0].Version != 1 {
+		t.Fatalf("embedded migrations = %+v", migs)
+	}
+	first := migs[0]
+	// Исправления схемы — новыми версиями, а не правкой применённых файлов.
+	if len(migs) < 3 || migs[2].Version != 3 || migs[2].Name != "ledger_restrict" || migs[2].Down == "" {
+		t.Errorf("embedded migrations = %+v, want 0003_ledger_restrict", migs)
+	}
+
+	if err := Migrations.verify(map[int64]appliedMigration{1: {Version: 1, Checksum: first.Checksum}}); err != nil {
+		t.Errorf("verify(matching) = %v", err)
+	}
+	if err := Migrations.verify(map[int64]appliedMigration{1: {Version: 1, Checksum: "edited"}}); !errors.Is(err, ErrMigrationChecksum) {
+		t.Errorf("verify(edited) = %v, want ErrMigrationChecksum", err)
+	}
+	if err := Migrations.verify(map[int64]appliedMigration{9999: {Version: 9999}}); !errors.Is(err, ErrMigrationUnknown) {
+		t.Errorf("verify(unknown) = %v, want ErrMigrationUnknown", err)
+	}
+}
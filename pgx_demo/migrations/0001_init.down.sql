@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS type_samples;
+DROP TABLE IF EXISTS accounts;
+DROP TABLE IF EXISTS app_users;
@@ -0,0 +1,28 @@
+-- Базовая схема примеров. IF NOT EXISTS — чтобы миграция спокойно «накатилась»
+-- на базы, созданные ещё старым BootstrapEnsureSchema без schema_migrations.
+CREATE TABLE IF NOT EXISTS app_users (
+	id          BIGSERIAL PRIMARY KEY,
+	email       TEXT UNIQUE NOT NULL,
+	name        TEXT NOT NULL,
+	middle_name TEXT,
+	last_login  TIMESTAMPTZ,
+	is_active   BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+CREATE TABLE IF NOT EXISTS accounts (
+	user_id BIGINT PRIMARY KEY REFERENCES app_users(id) ON DELETE CASCADE,
+	balance NUMERIC(12,2) NOT NULL
+);
+
+-- Отдельная таблица для демонстрации работы с типами и NULL (pgtype.*)
+CREATE TABLE IF NOT EXISTS type_samples (
+	id   BIGSERIAL PRIMARY KEY,
+	uid  UUID,
+	i2   SMALLINT,
+	i4   INTEGER,
+	i8   BIGINT,
+	flag BOOLEAN,
+	note TEXT,
+	num  NUMERIC(12,2),
+	ts   TIMESTAMPTZ
+);
@@ -0,0 +1,32 @@
+-- Журнал проводок (append-only). Каждое изменение accounts.balance — это проводка из двух
+-- строк с общим posting_id и суммой amount = 0 (двойная запись).
+CREATE SEQUENCE ledger_postings_seq;
+
+CREATE TABLE ledger_entries (
+	id         BIGSERIAL PRIMARY KEY,
+	posting_id BIGINT NOT NULL,
+	-- NULL — внешний контрагент (пополнение/вывод): у него нет строки в accounts
+	user_id    BIGINT REFERENCES accounts(user_id) ON DELETE CASCADE,
+	amount     NUMERIC(12,2) NOT NULL CHECK (amount <> 0),
+	memo       TEXT,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX ledger_entries_user_id_idx ON ledger_entries (user_id, id);
+CREATE INDEX ledger_entries_posting_id_idx ON ledger_entries (posting_id);
+
+-- Запрещаем UPDATE/DELETE. Исключение — каскадное удаление вместе со счётом:
+-- его выполняет RI-триггер, поэтому глубина вложенности триггеров > 1.
+CREATE FUNCTION ledger_entries_append_only() RETURNS trigger
+LANGUAGE plpgsql AS $$
+BEGIN
+	IF TG_OP = 'DELETE' AND pg_trigger_depth() > 1 THEN
+		RETURN OLD;
+	END IF;
+	RAISE EXCEPTION 'ledger_entries is append-only (%)', TG_OP;
+END
+$$;
+
+CREATE TRIGGER ledger_entries_append_only
+	BEFORE UPDATE OR DELETE ON ledger_entries
+	FOR EACH ROW EXECUTE FUNCTION ledger_entries_append_only();
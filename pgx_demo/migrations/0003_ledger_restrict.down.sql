@@ -0,0 +1,15 @@
+-- Возврат к поведению 0002. Проводки начальных остатков остаются: журнал append-only.
+CREATE OR REPLACE FUNCTION ledger_entries_append_only() RETURNS trigger
+LANGUAGE plpgsql AS $$
+BEGIN
+	IF TG_OP = 'DELETE' AND pg_trigger_depth() > 1 THEN
+		RETURN OLD;
+	END IF;
+	RAISE EXCEPTION 'ledger_entries is append-only (%)', TG_OP;
+END
+$$;
+
+ALTER TABLE ledger_entries
+	DROP CONSTRAINT ledger_entries_user_id_fkey,
+	ADD CONSTRAINT ledger_entries_user_id_fkey
+		FOREIGN KEY (user_id) REFERENCES accounts(user_id) ON DELETE CASCADE;
@@ -0,0 +1,28 @@
+-- Счёт с проводками удалять нельзя: каскад из 0002 удалял только одну ногу каждой проводки
+-- удаляемого счёта, и проводки переставали сходиться в ноль.
+ALTER TABLE ledger_entries
+	DROP CONSTRAINT ledger_entries_user_id_fkey,
+	ADD CONSTRAINT ledger_entries_user_id_fkey
+		FOREIGN KEY (user_id) REFERENCES accounts(user_id) ON DELETE RESTRICT;
+
+-- Журнал append-only без исключений (0002 пропускала DELETE из каскада).
+CREATE OR REPLACE FUNCTION ledger_entries_append_only() RETURNS trigger
+LANGUAGE plpgsql AS $$
+BEGIN
+	RAISE EXCEPTION 'ledger_entries is append-only (%)', TG_OP;
+END
+$$;
+
+-- Начальные остатки: деньги, лежавшие на счетах до появления журнала, проводятся со внешнего
+-- контрагента — по одной проводке на счёт, чей баланс расходится с суммой журнала.
+-- Иначе Reconcile сразу после миграции показывает расхождение.
+WITH opening AS (
+	SELECT nextval('ledger_postings_seq') AS posting_id, a.user_id,
+	       a.balance - COALESCE((SELECT SUM(l.amount) FROM ledger_entries l WHERE l.user_id = a.user_id), 0) AS amount
+	  FROM accounts a
+	 WHERE a.balance <> COALESCE((SELECT SUM(l.amount) FROM ledger_entries l WHERE l.user_id = a.user_id), 0)
+)
+INSERT INTO ledger_entries(posting_id, user_id, amount, memo)
+SELECT o.posting_id, leg.user_id, leg.amount, 'opening balance'
+  FROM opening o, LATERAL (VALUES (NULL::bigint, -o.amount), (o.user_id, o.amount)) AS leg(user_id, amount)
+ ORDER BY o.user_id, leg.user_id NULLS FIRST;
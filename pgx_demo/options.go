@@ -0,0 +1,318 @@
+// Функциональные опции для BuildPool.
+// Правило приоритета для каждого параметра пула:
+//  1. явная опция (WithMaxConns, WithLifetime, ...);
+//  2. параметр из DSN (pool_max_conns, pool_max_conn_lifetime, application_name, ...);
+//  3. значение по умолчанию из этого пакета (defaultMaxConns и т.д.).
+
+package pgx_demo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/multitracer"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Значения по умолчанию — раньше были «зашиты» прямо в BuildPool.
+// Теперь применяются, только если параметр не задан ни опцией, ни в DSN.
+const (
+	defaultMaxConns          int32 = 10
+	defaultMinConns          int32 = 2
+	defaultMaxConnLifetime         = 30 * time.Minute
+	defaultMaxConnIdleTime         = 5 * time.Minute
+	defaultHealthCheckPeriod       = time.Minute
+	defaultAppName                 = "pgxpool-demo"
+)
+
+// ErrInvalidPoolConfig — противоречивые или недопустимые настройки пула
+// (MinConns > MaxConns, нулевые времена жизни и т.п.). Проверяйте через errors.Is.
+var ErrInvalidPoolConfig = errors.New("invalid pool config")
+
+// Hooks — пользовательские хуки пула. Они выполняются ПОСЛЕ встроенных хуков BuildPool
+// (application_name, prepared statements) в порядке передачи опций.
+// Для BeforeAcquire/AfterRelease соединение остаётся в работе, только если ВСЕ хуки вернули true.
+type Hooks struct {
+	BeforeConnect func(context.Context, *pgx.ConnConfig) error
+	AfterConnect  func(context.Context, *pgx.Conn) error
+	BeforeAcquire func(context.Context, *pgx.Conn) bool
+	AfterRelease  func(*pgx.Conn) bool
+	BeforeClose   func(*pgx.Conn)
+}
+
+// PoolOption — функциональная опция BuildPool/BuildPoolConfig.
+type PoolOption func(*poolOptions)
+
+// poolOptions — накопленные опции. nil-указатель означает «не задано опцией».
+type poolOptions struct {
+	maxConns          *int32
+	minConns          *int32
+	minIdleConns      *int32
+	maxConnLifetime   *time.Duration
+	maxConnIdleTime   *time.Duration
+	healthCheckPeriod *time.Duration
+	appName           *string
+	hooks             []Hooks
+	queryTracers      []pgx.QueryTracer
+	acquireTracers    []pgxpool.AcquireTracer
+	failover          *FailoverOptions
+	health            *HealthPolicy
+	reset             *sessionResetter
+	sessionInit       []string
+}
+
+// WithMaxConns — верхний предел одновременных соединений.
+func WithMaxConns(n int32) PoolOption {
+	return func(o *poolOptions) { o.maxConns = &n }
+}
+
+// WithMinConns — минимально поддерживаемое количество соединений.
+func WithMinConns(n int32) PoolOption {
+	return func(o *poolOptions) { o.minConns = &n }
+}
+
+// WithMinIdleConns — минимальное количество простаивающих соединений.
+func WithMinIdleConns(n int32) PoolOption {
+	return func(o *poolOptions) { o.minIdleConns = &n }
+}
+
+// WithLifetime — «возраст» соединения и максимум простоя до закрытия.
+func WithLifetime(maxLifetime, maxIdle time.Duration) PoolOption {
+	return func(o *poolOptions) {
+		o.maxConnLifetime = &maxLifetime
+		o.maxConnIdleTime = &maxIdle
+	}
+}
+
+// WithHealthCheckPeriod — период фоновой проверки живости соединений.
+func WithHealthCheckPeriod(d time.Duration) PoolOption {
+	return func(o *poolOptions) { o.healthCheckPeriod = &d }
+}
+
+// WithAppName — application_name, под которым соединения видны в pg_stat_activity.
+func WithAppName(name string) PoolOption {
+	return func(o *poolOptions) { o.appName = &name }
+}
+
+// WithSessionInit — команды настройки сессии (SET search_path, SET ROLE, ...), выполняются на каждом
+// новом соединении до подготовки выражений: prepared-выражение разрешает имена таблиц по search_path
+// на момент PREPARE. После сброса сессии (WithSessionReset) команды выполняются повторно.
+// Идут мимо трассировщиков, поэтому HealthPolicy не считает их изменением сессии.
+func WithSessionInit(sql ...string) PoolOption {
+	return func(o *poolOptions) { o.sessionInit = append(o.sessionInit, sql...) }
+}
+
+// WithHooks — добавить пользовательские хуки. Опцию можно передавать несколько раз.
+func WithHooks(h Hooks) PoolOption {
+	return func(o *poolOptions) { o.hooks = append(o.hooks, h) }
+}
+
+// WithMetrics — подключить сборщик метрик пула: он получает длительность каждого Acquire
+// (для p99 ожидания). Сам сбор pool.Stat() запускается отдельно: m.Run(ctx, pool, interval).
+func WithMetrics(m *PoolMetrics) PoolOption {
+	return func(o *poolOptions) { o.acquireTracers = append(o.acquireTracers, m) }
+}
+
+// WithTracer — трассировщик запросов (например, NewSpanTracer). Опцию можно передавать несколько раз:
+// трассировщики объединяются, и каждый получает те интерфейсы (Batch/CopyFrom/Prepare/Connect/Acquire),
+// которые реализует.
+func WithTracer(t pgx.QueryTracer) PoolOption {
+	return func(o *poolOptions) { o.queryTracers = append(o.queryTracers, t) }
+}
+
+// WithSlog — структурированные логи через slog: запросы (трассировщик) и жизненный цикл соединений (хуки).
+func WithSlog(a *SlogAdapter) PoolOption {
+	return func(o *poolOptions) {
+		o.queryTracers = append(o.queryTracers, a.Tracer())
+		o.hooks = append(o.hooks, a.Hooks())
+	}
+}
+
+// WithHealthPolicy — политика здоровья соединений (см. HealthPolicy): встроенные BeforeAcquire/AfterRelease
+// выбрасывают соединения, которые она забраковала. Политика же считает запросы как трассировщик.
+func WithHealthPolicy(p *HealthPolicy) PoolOption {
+	return func(o *poolOptions) {
+		o.health = p
+		o.queryTracers = append(o.queryTracers, p)
+	}
+}
+
+// applyPoolOptions — применяет опции, параметры DSN и дефолты к cfg по правилу приоритета
+// и валидирует результат. Хуки из опций НЕ применяются: их нужно навесить после встроенных (см. applyHooks).
+func applyPoolOptions(cfg *pgxpool.Config, dsn string, opts []PoolOption) (*poolOptions, error) {
+	// pgxpool.ParseConfig вырезает pool_* из RuntimeParams и подставляет свои дефолты,
+	// поэтому «было ли значение в DSN» узнаём через обычный pgx.ParseConfig, где они ещё на месте.
+	raw, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("ParseConfig: %w", err)
+	}
+	inDSN := func(key string) bool {
+		_, ok := raw.RuntimeParams[key]
+		return ok
+	}
+
+	o := &poolOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	cfg.MaxConns = pickInt32(o.maxConns, inDSN("pool_max_conns"), cfg.MaxConns, defaultMaxConns)
+	// Дефолт MinConns не больше MaxConns: ошибка — только явное противоречие из опций или DSN.
+	cfg.MinConns = pickInt32(o.minConns, inDSN("pool_min_conns"), cfg.MinConns, min(defaultMinConns, cfg.MaxConns))
+	cfg.MinIdleConns = pickInt32(o.minIdleConns, inDSN("pool_min_idle_conns"), cfg.MinIdleConns, cfg.MinIdleConns)
+	cfg.MaxConnLifetime = pickDuration(o.maxConnLifetime, inDSN("pool_max_conn_lifetime"), cfg.MaxConnLifetime, defaultMaxConnLifetime)
+	cfg.MaxConnIdleTime = pickDuration(o.maxConnIdleTime, inDSN("pool_max_conn_idle_time"), cfg.MaxConnIdleTime, defaultMaxConnIdleTime)
+	cfg.HealthCheckPeriod = pickDuration(o.healthCheckPeriod, inDSN("pool_health_check_period"), cfg.HealthCheckPeriod, defaultHealthCheckPeriod)
+
+	// application_name передаём стартовым параметром соединения — без лишнего round-trip в AfterConnect.
+	switch {
+	case o.appName != nil:
+		cfg.ConnConfig.RuntimeParams["application_name"] = *o.appName
+	case !inDSN("application_name"):
+		cfg.ConnConfig.RuntimeParams["application_name"] = defaultAppName
+	}
+
+	if err := validatePoolConfig(cfg); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// pickInt32 — выбор значения по правилу «опция > DSN > дефолт».
+func pickInt32(opt *int32, inDSN bool, fromDSN, def int32) int32 {
+	switch {
+	case opt != nil:
+		return *opt
+	case inDSN:
+		return fromDSN
+	default:
+		return def
+	}
+}
+
+// pickDuration — то же правило для длительностей.
+func pickDuration(opt *time.Duration, inDSN bool, fromDSN, def time.Duration) time.Duration {
+	switch {
+	case opt != nil:
+		return *opt
+	case inDSN:
+		return fromDSN
+	default:
+		return def
+	}
+}
+
+// validatePoolConfig — отлавливаем противоречивые настройки до создания пула,
+// а не по странному поведению в проде. Возвращает все найденные проблемы сразу.
+func validatePoolConfig(cfg *pgxpool.Config) error {
+	var errs []error
+	if cfg.MaxConns < 1 {
+		errs = append(errs, fmt.Errorf("%w: MaxConns must be > 0, got %d", ErrInvalidPoolConfig, cfg.MaxConns))
+	}
+	if cfg.MinConns < 0 {
+		errs = append(errs, fmt.Errorf("%w: MinConns must be >= 0, got %d", ErrInvalidPoolConfig, cfg.MinConns))
+	}
+	if cfg.MinConns > cfg.MaxConns {
+		errs = append(errs, fmt.Errorf("%w: MinConns (%d) > MaxConns (%d)", ErrInvalidPoolConfig, cfg.MinConns, cfg.MaxConns))
+	}
+	if cfg.MinIdleConns < 0 {
+		errs = append(errs, fmt.Errorf("%w: MinIdleConns must be >= 0, got %d", ErrInvalidPoolConfig, cfg.MinIdleConns))
+	}
+	if cfg.MinIdleConns > cfg.MaxConns {
+		errs = append(errs, fmt.Errorf("%w: MinIdleConns (%d) > MaxConns (%d)", ErrInvalidPoolConfig, cfg.MinIdleConns, cfg.MaxConns))
+	}
+	if cfg.MaxConnLifetime <= 0 {
+		errs = append(errs, fmt.Errorf("%w: MaxConnLifetime must be > 0, got %s", ErrInvalidPoolConfig, cfg.MaxConnLifetime))
+	}
+	if cfg.MaxConnIdleTime <= 0 {
+		errs = append(errs, fmt.Errorf("%w: MaxConnIdleTime must be > 0, got %s", ErrInvalidPoolConfig, cfg.MaxConnIdleTime))
+	}
+	if cfg.HealthCheckPeriod <= 0 {
+		errs = append(errs, fmt.Errorf("%w: HealthCheckPeriod must be > 0, got %s", ErrInvalidPoolConfig, cfg.HealthCheckPeriod))
+	}
+	return errors.Join(errs...)
+}
+
+// applyHooks — «склеивает» уже установленные в cfg встроенные хуки с пользовательскими.
+func applyHooks(cfg *pgxpool.Config, extra []Hooks) {
+	if len(extra) == 0 {
+		return
+	}
+	all := append([]Hooks{{
+		BeforeConnect: cfg.BeforeConnect,
+		AfterConnect:  cfg.AfterConnect,
+		BeforeAcquire: cfg.BeforeAcquire,
+		AfterRelease:  cfg.AfterRelease,
+		BeforeClose:   cfg.BeforeClose,
+	}}, extra...)
+
+	cfg.BeforeConnect = func(ctx context.Context, cc *pgx.ConnConfig) error {
+		for _, h := range all {
+			if h.BeforeConnect != nil {
+				if err := h.BeforeConnect(ctx, cc); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	cfg.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+		for _, h := range all {
+			if h.AfterConnect != nil {
+				if err := h.AfterConnect(ctx, conn); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	cfg.BeforeAcquire = func(ctx context.Context, conn *pgx.Conn) bool {
+		for _, h := range all {
+			if h.BeforeAcquire != nil && !h.BeforeAcquire(ctx, conn) {
+				return false
+			}
+		}
+		return true
+	}
+	cfg.AfterRelease = func(conn *pgx.Conn) bool {
+		for _, h := range all {
+			if h.AfterRelease != nil && !h.AfterRelease(conn) {
+				return false
+			}
+		}
+		return true
+	}
+	cfg.BeforeClose = func(conn *pgx.Conn) {
+		for _, h := range all {
+			if h.BeforeClose != nil {
+				h.BeforeClose(conn)
+			}
+		}
+	}
+}
+
+// initSession — команды WithSessionInit напрямую через pgconn (без трассировщиков и кэша выражений).
+func initSession(ctx context.Context, pc *pgconn.PgConn, sqls []string) error {
+	for _, sql := range sqls {
+		if _, err := pc.Exec(ctx, sql).ReadAll(); err != nil {
+			return fmt.Errorf("session init %q: %w", sql, err)
+		}
+	}
+	return nil
+}
+
+// applyTracers — собирает трассировщики из опций в один ConnConfig.Tracer.
+// pgxpool сам проверяет, реализует ли Tracer AcquireTracer/ReleaseTracer, поэтому
+// multitracer.Tracer подходит и для трассировки пула, и для трассировки запросов.
+func applyTracers(cfg *pgxpool.Config, o *poolOptions) {
+	if len(o.queryTracers) == 0 && len(o.acquireTracers) == 0 {
+		return
+	}
+	t := multitracer.New(o.queryTracers...)
+	t.PoolAcquireTracers = append(t.PoolAcquireTracers, o.acquireTracers...)
+	cfg.ConnConfig.Tracer = t
+}
@@ -0,0 +1,142 @@
+package pgx_demo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const testDSN = "postgres://u:p@localhost:5432/app?sslmode=disable"
+
+func TestBuildPoolConfigDefaults(t *testing.T) {
+	cfg, err := BuildPoolConfig(testDSN)
+	if err != nil {
+		t.Fatalf("BuildPoolConfig: %v", err)
+	}
+	if cfg.MaxConns != defaultMaxConns || cfg.MinConns != defaultMinConns {
+		t.Errorf("conns = %d/%d, want %d/%d", cfg.MaxConns, cfg.MinConns, defaultMaxConns, defaultMinConns)
+	}
+	if cfg.MaxConnLifetime != defaultMaxConnLifetime || cfg.MaxConnIdleTime != defaultMaxConnIdleTime {
+		t.Errorf("lifetimes = %s/%s", cfg.MaxConnLifetime, cfg.MaxConnIdleTime)
+	}
+	if cfg.HealthCheckPeriod != defaultHealthCheckPeriod {
+		t.Errorf("HealthCheckPeriod = %s", cfg.HealthCheckPeriod)
+	}
+	if got := cfg.ConnConfig.RuntimeParams["application_name"]; got != defaultAppName {
+		t.Errorf("application_name = %q", got)
+	}
+}
+
+func TestBuildPoolConfigPrecedence(t *testing.T) {
+	dsn := testDSN + "&pool_max_conns=20&pool_min_conns=3&pool_max_conn_lifetime=1h&application_name=from-dsn"
+
+	cfg, err := BuildPoolConfig(dsn)
+	if err != nil {
+		t.Fatalf("BuildPoolConfig: %v", err)
+	}
+	// DSN побеждает дефолты.
+	if cfg.MaxConns != 20 || cfg.MinConns != 3 || cfg.MaxConnLifetime != time.Hour {
+		t.Errorf("DSN values not applied: %d/%d/%s", cfg.MaxConns, cfg.MinConns, cfg.MaxConnLifetime)
+	}
+	if got := cfg.ConnConfig.RuntimeParams["application_name"]; got != "from-dsn" {
+		t.Errorf("application_name = %q, want from-dsn", got)
+	}
+	// Не заданное в DSN берётся из дефолтов пакета.
+	if cfg.MaxConnIdleTime != defaultMaxConnIdleTime {
+		t.Errorf("MaxConnIdleTime = %s", cfg.MaxConnIdleTime)
+	}
+
+	// Опции побеждают DSN.
+	cfg, err = BuildPoolConfig(dsn, WithMaxConns(5), WithLifetime(2*time.Hour, time.Minute), WithAppName("from-opt"))
+	if err != nil {
+		t.Fatalf("BuildPoolConfig: %v", err)
+	}
+	if cfg.MaxConns != 5 || cfg.MinConns != 3 {
+		t.Errorf("conns = %d/%d, want 5/3", cfg.MaxConns, cfg.MinConns)
+	}
+	if cfg.MaxConnLifetime != 2*time.Hour || cfg.MaxConnIdleTime != time.Minute {
+		t.Errorf("lifetimes = %s/%s", cfg.MaxConnLifetime, cfg.MaxConnIdleTime)
+	}
+	if got := cfg.ConnConfig.RuntimeParams["application_name"]; got != "from-opt" {
+		t.Errorf("application_name = %q, want from-opt", got)
+	}
+}
+
+func TestBuildPoolConfigValidation(t *testing.T) {
+	cases := map[string][]PoolOption{
+		"min > max":      {WithMaxConns(2), WithMinConns(5)},
+		"min idle > max": {WithMaxConns(2), WithMinConns(0), WithMinIdleConns(3)},
+		"zero max":       {WithMaxConns(0), WithMinConns(0)},
+		"zero lifetime":  {WithLifetime(0, time.Minute)},
+		"zero idle":      {WithLifetime(time.Hour, 0)},
+		"zero health":    {WithHealthCheckPeriod(0)},
+	}
+	for name, opts := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := BuildPoolConfig(testDSN, opts...)
+			if !errors.Is(err, ErrInvalidPoolConfig) {
+				t.Fatalf("err = %v, want ErrInvalidPoolConfig", err)
+			}
+		})
+	}
+
+	// Явное противоречие внутри DSN — ошибка.
+	if _, err := BuildPoolConfig(testDSN + "&pool_max_conns=1&pool_min_conns=3"); !errors.Is(err, ErrInvalidPoolConfig) {
+		t.Fatalf("err = %v, want ErrInvalidPoolConfig", err)
+	}
+}
+
+func TestBuildPoolConfigClampsDefaultMinConns(t *testing.T) {
+	// pool_max_conns=1 меньше defaultMinConns: дефолт подрезается, а не отвергает корректный DSN.
+	cfg, err := BuildPoolConfig(testDSN + "&pool_max_conns=1")
+	if err != nil {
+		t.Fatalf("BuildPoolConfig: %v", err)
+	}
+	if cfg.MaxConns != 1 || cfg.MinConns != 1 {
+		t.Errorf("MaxConns/MinConns = %d/%d, want 1/1", cfg.MaxConns, cfg.MinConns)
+	}
+	cfg, err = BuildPoolConfig(testDSN, WithMaxConns(1))
+	if err != nil {
+		t.Fatalf("BuildPoolConfig(WithMaxConns(1)): %v", err)
+	}
+	if cfg.MinConns != 1 {
+		t.Errorf("MinConns = %d, want 1", cfg.MinConns)
+	}
+}
+
+func TestBuildPoolConfigHooksChain(t *testing.T) {
+	var calls []string
+	cfg, err := BuildPoolConfig(testDSN,
+		WithHooks(Hooks{
+			BeforeAcquire: func(context.Context, *pgx.Conn) bool { calls = append(calls, "a1"); return true },
+			AfterRelease:  func(*pgx.Conn) bool { calls = append(calls, "r1"); return false },
+		}),
+		WithHooks(Hooks{
+			BeforeAcquire: func(context.Context, *pgx.Conn) bool { calls = append(calls, "a2"); return false },
+			AfterRelease:  func(*pgx.Conn) bool { calls = append(calls, "r2"); return true },
+		}),
+	)
+	if err != nil {
+		t.Fatalf("BuildPoolConfig: %v", err)
+	}
+
+	if cfg.BeforeAcquire(context.Background(), nil) {
+		t.Error("BeforeAcquire = true, want false from second hook")
+	}
+	if cfg.AfterRelease(nil) {
+		t.Error("AfterRelease = true, want false from first hook")
+	}
+	// Первый false в AfterRelease останавливает цепочку.
+	want := []string{"a1", "a2", "r1"}
+	if len(calls) != len(want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Fatalf("calls = %v, want %v", calls, want)
+		}
+	}
+}
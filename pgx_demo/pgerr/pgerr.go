@@ -0,0 +1,175 @@
+// Package pgerr — классификация ошибок Postgres/pgx.
+// *pgconn.PgError несёт SQLSTATE-код; здесь он превращается в sentinel-ошибки (ErrUniqueViolation,
+// ErrSerialization, ErrConnLost, ...), которые можно проверять через errors.Is, а детали
+// (имя ограничения, таблица, колонка) — доставать через errors.As в *pgerr.Error.
+// Исходная *pgconn.PgError при этом остаётся доступной через errors.As.
+package pgerr
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Классы ошибок. Проверяйте через errors.Is(err, pgerr.ErrXxx).
+var (
+	ErrUniqueViolation = errors.New("unique violation")         // 23505
+	ErrForeignKey      = errors.New("foreign key violation")    // 23503
+	ErrNotNull         = errors.New("not null violation")       // 23502
+	ErrCheckViolation  = errors.New("check violation")          // 23514
+	ErrSerialization   = errors.New("serialization failure")    // 40001
+	ErrDeadlock        = errors.New("deadlock detected")        // 40P01
+	ErrLockNotAvail    = errors.New("lock not available")       // 55P03
+	ErrQueryCanceled   = errors.New("query canceled")           // 57014, отмена/таймаут контекста
+	ErrUnavailable     = errors.New("database unavailable")     // класс 53, 57P01..57P03
+	ErrConnLost        = errors.New("database connection lost") // класс 08, обрыв сети, EOF
+)
+
+// SQLSTATE-коды, на которые опирается классификация.
+const (
+	CodeUniqueViolation      = "23505"
+	CodeForeignKeyViolation  = "23503"
+	CodeNotNullViolation     = "23502"
+	CodeCheckViolation       = "23514"
+	CodeSerializationFailure = "40001"
+	CodeDeadlockDetected     = "40P01"
+	CodeLockNotAvailable     = "55P03"
+	CodeQueryCanceled        = "57014"
+	CodeAdminShutdown        = "57P01"
+	CodeCrashShutdown        = "57P02"
+	CodeCannotConnectNow     = "57P03"
+)
+
+// Error — классифицированная ошибка. Kind — один из sentinel'ов выше.
+// Constraint/Table/Column заполняются из PgError (для нарушений ограничений).
+type Error struct {
+	Kind       error
+	Code       string
+	Constraint string
+	Table      string
+	Column     string
+	Err        error
+}
+
+func (e *Error) Error() string { return e.Kind.Error() + ": " + e.Err.Error() }
+
+// Unwrap отдаёт и класс, и исходную ошибку: errors.Is(err, ErrUniqueViolation)
+// и errors.As в *pgconn.PgError работают одновременно.
+func (e *Error) Unwrap() []error { return []error{e.Kind, e.Err} }
+
+// Classify оборачивает err в *Error, если удаётся определить класс; иначе возвращает err без изменений.
+// nil и уже классифицированные ошибки возвращаются как есть.
+func Classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	var ce *Error
+	if errors.As(err, &ce) {
+		return err
+	}
+	kind := kindOf(err)
+	if kind == nil {
+		return err
+	}
+	out := &Error{Kind: kind, Err: err}
+	var pge *pgconn.PgError
+	if errors.As(err, &pge) {
+		out.Code = pge.Code
+		out.Constraint = pge.ConstraintName
+		out.Table = pge.TableName
+		out.Column = pge.ColumnName
+	}
+	return out
+}
+
+// kindOf — класс ошибки или nil, если класс неизвестен.
+func kindOf(err error) error {
+	var pge *pgconn.PgError
+	if errors.As(err, &pge) {
+		return kindOfCode(pge.Code)
+	}
+	// Отмена/таймаут контекста проверяем раньше обрыва: pgconn закрывает соединение
+	// при отмене, и такая ошибка выглядит и как «отмена», и как «обрыв».
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return ErrQueryCanceled
+	}
+	if isConnLost(err) {
+		return ErrConnLost
+	}
+	return nil
+}
+
+func kindOfCode(code string) error {
+	switch code {
+	case CodeUniqueViolation:
+		return ErrUniqueViolation
+	case CodeForeignKeyViolation:
+		return ErrForeignKey
+	case CodeNotNullViolation:
+		return ErrNotNull
+	case CodeCheckViolation:
+		return ErrCheckViolation
+	case CodeSerializationFailure:
+		return ErrSerialization
+	case CodeDeadlockDetected:
+		return ErrDeadlock
+	case CodeLockNotAvailable:
+		return ErrLockNotAvail
+	case CodeQueryCanceled:
+		return ErrQueryCanceled
+	case CodeAdminShutdown, CodeCrashShutdown, CodeCannotConnectNow:
+		return ErrUnavailable
+	}
+	switch {
+	case strings.HasPrefix(code, "08"): // connection_exception
+		return ErrConnLost
+	case strings.HasPrefix(code, "53"): // insufficient_resources (too_many_connections, out_of_memory, ...)
+		return ErrUnavailable
+	}
+	return nil
+}
+
+// isConnLost — ошибки транспорта: соединение не установлено или оборвалось.
+func isConnLost(err error) bool {
+	var connectErr *pgconn.ConnectError
+	var netErr net.Error
+	return pgconn.SafeToRetry(err) ||
+		errors.As(err, &connectErr) ||
+		errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed)
+}
+
+// IsRetryable — транзакцию можно безопасно повторить целиком «как есть»:
+// конфликт сериализации, дедлок или потеря соединения (незакоммиченная транзакция откатилась сервером).
+// Внимание: обрыв во время COMMIT сюда тоже попадает — исход такой транзакции неизвестен (см. pgx_demo.ErrTxCommitUnknown).
+func IsRetryable(err error) bool {
+	switch kindOf(err) {
+	case ErrSerialization, ErrDeadlock, ErrConnLost:
+		return true
+	}
+	return false
+}
+
+// IsTransient — состояние, скорее всего, временное и повтор чуть позже может пройти:
+// всё из IsRetryable плюс перегрузка/рестарт сервера, недоступная блокировка и statement_timeout (57014).
+// Отмена контекста вызывающим кодом временной не считается.
+func IsTransient(err error) bool {
+	if IsRetryable(err) {
+		return true
+	}
+	var pge *pgconn.PgError
+	if !errors.As(err, &pge) {
+		return false
+	}
+	switch kindOfCode(pge.Code) {
+	case ErrUnavailable, ErrLockNotAvail, ErrQueryCanceled:
+		return true
+	}
+	return false
+}
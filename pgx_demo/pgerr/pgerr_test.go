@@ -0,0 +1,93 @@
+package pgerr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestClassify(t *testing.T) {
+	opErr := &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}
+
+	cases := []struct {
+		name      string
+		err       error
+		kind      error
+		retryable bool
+		transient bool
+	}{
+		{"unique", &pgconn.PgError{Code: "23505", ConstraintName: "app_users_email_key"}, ErrUniqueViolation, false, false},
+		{"foreign key", &pgconn.PgError{Code: "23503", ConstraintName: "accounts_user_id_fkey"}, ErrForeignKey, false, false},
+		{"not null", &pgconn.PgError{Code: "23502", ColumnName: "name"}, ErrNotNull, false, false},
+		{"check", &pgconn.PgError{Code: "23514"}, ErrCheckViolation, false, false},
+		{"serialization", &pgconn.PgError{Code: "40001"}, ErrSerialization, true, true},
+		{"deadlock", &pgconn.PgError{Code: "40P01"}, ErrDeadlock, true, true},
+		{"lock not available", &pgconn.PgError{Code: "55P03"}, ErrLockNotAvail, false, true},
+		{"statement timeout", &pgconn.PgError{Code: "57014"}, ErrQueryCanceled, false, true},
+		{"admin shutdown", &pgconn.PgError{Code: "57P01"}, ErrUnavailable, false, true},
+		{"cannot connect now", &pgconn.PgError{Code: "57P03"}, ErrUnavailable, false, true},
+		{"too many connections", &pgconn.PgError{Code: "53300"}, ErrUnavailable, false, true},
+		{"connection failure", &pgconn.PgError{Code: "08006"}, ErrConnLost, true, true},
+		{"ctx canceled", fmt.Errorf("query: %w", context.Canceled), ErrQueryCanceled, false, false},
+		{"ctx deadline", context.DeadlineExceeded, ErrQueryCanceled, false, false},
+		{"eof", io.ErrUnexpectedEOF, ErrConnLost, true, true},
+		{"net error", opErr, ErrConnLost, true, true},
+		{"syntax error", &pgconn.PgError{Code: "42601"}, nil, false, false},
+		{"plain error", errors.New("boom"), nil, false, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Classify(tc.err)
+			if tc.kind == nil {
+				if got != tc.err {
+					t.Fatalf("Classify() = %v, want unchanged", got)
+				}
+			} else {
+				if !errors.Is(got, tc.kind) {
+					t.Fatalf("Classify() = %v, want kind %v", got, tc.kind)
+				}
+				if !errors.Is(got, tc.err) {
+					t.Fatalf("Classify() lost the original error")
+				}
+			}
+			if r := IsRetryable(tc.err); r != tc.retryable {
+				t.Errorf("IsRetryable = %v, want %v", r, tc.retryable)
+			}
+			if r := IsTransient(tc.err); r != tc.transient {
+				t.Errorf("IsTransient = %v, want %v", r, tc.transient)
+			}
+			// Предикаты работают и на уже классифицированной ошибке.
+			if IsRetryable(got) != tc.retryable || IsTransient(got) != tc.transient {
+				t.Errorf("predicates differ on classified error")
+			}
+		})
+	}
+}
+
+func TestClassifyDetails(t *testing.T) {
+	src := &pgconn.PgError{Code: "23505", ConstraintName: "app_users_email_key", TableName: "app_users"}
+	err := Classify(fmt.Errorf("upsert: %w", src))
+
+	var ce *Error
+	if !errors.As(err, &ce) {
+		t.Fatalf("errors.As(*Error) failed for %v", err)
+	}
+	if ce.Code != "23505" || ce.Constraint != "app_users_email_key" || ce.Table != "app_users" {
+		t.Errorf("details = %+v", ce)
+	}
+	var pge *pgconn.PgError
+	if !errors.As(err, &pge) || pge != src {
+		t.Error("original *pgconn.PgError must stay reachable")
+	}
+	if Classify(err) != err {
+		t.Error("Classify must be idempotent")
+	}
+	if Classify(nil) != nil {
+		t.Error("Classify(nil) must be nil")
+	}
+}
@@ -12,28 +12,17 @@ import (
 	"strings"
 	"time"
 
+	"github.com/MrTeeett/pgx-v5-pool-examples/pgx_demo/pgerr"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-// Имена подготовленных выражений (prepare) — мы будем готовить их
-// из хука AfterConnect, чтобы каждое соединение пула имело одинаковый набор.
-const (
-	psInsertUser       = "ps_insert_user"
-	psSetLastLogin     = "ps_set_last_login"
-	psGetUserByEmail   = "ps_get_user_by_email"
-	psGetUserIdByEmail = "ps_get_user_id_by_email"
-	psEnsureAccount    = "ps_ensure_account"
-	psGetBalance       = "ps_get_balance"
-	psSelectUsersLight = "ps_select_users_light"
-	// Для демонстрации типов и NULL-обработки на отдельной таблице
-	psInsertTypeSample = "ps_insert_type_sample"
-	psGetTypeSample    = "ps_get_type_sample"
-)
+// Подготовленные выражения (prepare) объявлены декларативно в statements.go (реестр Statements) —
+// мы готовим их из хука AfterConnect, чтобы каждое соединение пула имело одинаковый набор.
 
-// bootstrapEnsureSchema подключается напрямую (без пула) и создаёт таблицы.
+// bootstrapEnsureSchema подключается напрямую (без пула) и применяет миграции схемы.
 func BootstrapEnsureSchema(ctx context.Context, dsn string) error {
 	cfg, err := pgxpool.ParseConfig(dsn)
 	if err != nil {
@@ -47,134 +36,98 @@ func BootstrapEnsureSchema(ctx context.Context, dsn string) error {
 	}
 	defer conn.Close(ctx)
 
-	ddl := []string{
-		`CREATE TABLE IF NOT EXISTS app_users (
-			id          BIGSERIAL PRIMARY KEY,
-			email       TEXT UNIQUE NOT NULL,
-			name        TEXT NOT NULL,
-			middle_name TEXT,
-			last_login  TIMESTAMPTZ,
-			is_active   BOOLEAN NOT NULL DEFAULT TRUE
-		)`,
-		`CREATE TABLE IF NOT EXISTS accounts (
-			user_id BIGINT PRIMARY KEY REFERENCES app_users(id) ON DELETE CASCADE,
-			balance NUMERIC(12,2) NOT NULL
-		)`,
-		// Отдельная таблица для демонстрации работы с типами и NULL (pgtype.*)
-		`CREATE TABLE IF NOT EXISTS type_samples (
-			id   BIGSERIAL PRIMARY KEY,
-			uid  UUID,
-			i2   SMALLINT,
-			i4   INTEGER,
-			i8   BIGINT,
-			flag BOOLEAN,
-			note TEXT,
-			num  NUMERIC(12,2),
-			ts   TIMESTAMPTZ
-		)`,
-	}
-	for _, q := range ddl {
-		if _, err := conn.Exec(ctx, q); err != nil {
-			return fmt.Errorf("bootstrap DDL failed: %w (query=%s)", err, q)
-		}
+	// DDL живёт в версионных миграциях (migrations/*.sql, см. migrate.go).
+	if err := Migrations.Up(ctx, conn); err != nil {
+		return fmt.Errorf("bootstrap migrations: %w", err)
+	}
+
+	// Схема на месте — проверим, что все выражения реестра парсятся против неё.
+	// Так опечатка в SQL всплывёт здесь списком, а не первой ошибкой из AfterConnect пула.
+	if err := Statements.Validate(ctx, conn); err != nil {
+		return fmt.Errorf("validate statements: %w", err)
 	}
 	return nil
 }
 
-// buildPool: ParseConfig + тонкая настройка конфигурации пула.
+// BuildPoolConfig: ParseConfig + тонкая настройка конфигурации пула, без создания самого пула.
 // ВАЖНО: cfg.ConnConfig — это «конфиг одиночного соединения» (таймауты, user, dbname, ssl, прост/extended протокол и т.п.).
 // Параметры пула (MaxConns/MinConns/MaxConnLifetime/MaxConnIdleTime/HealthCheckPeriod + хуки)
 // лежат "рядом", но не в ConnConfig.
-func BuildPool(ctx context.Context, dsn string) (*pgxpool.Pool, error) {
+// Приоритет значений: опция (WithMaxConns и т.п.) > pool_* из DSN > дефолты пакета (см. options.go).
+func BuildPoolConfig(dsn string, opts ...PoolOption) (*pgxpool.Config, error) {
 	cfg, err := pgxpool.ParseConfig(dsn)
 	if err != nil {
 		return nil, fmt.Errorf("ParseConfig: %w", err)
 	}
 
-	// Пример тюнинга пула (можно переопределить то, что пришло из DSN):
-	cfg.MaxConns = 10                      // верхний предел одновременных соединений
-	cfg.MinConns = 2                       // минимально поддерживаемое количество
-	cfg.MaxConnLifetime = 30 * time.Minute // «возраст» соединения: после этого его лучше пересоздать
-	cfg.MaxConnIdleTime = 5 * time.Minute  // максимум простоя до закрытия
-	cfg.HealthCheckPeriod = time.Minute    // фоновая проверка живости коннектов
+	// Лимиты, возраст/простой соединений, health-check и application_name.
+	o, err := applyPoolOptions(cfg, dsn, opts)
+	if err != nil {
+		return nil, err
+	}
 
 	// Хук AfterConnect сработает на только что созданном соединении.
 	// Идеально подходит, чтобы «унифицировать» каждое соединение (SET'ы, prepared statements и т.п.).
 	cfg.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
-		// Для примера — проставим application_name, чтобы видеть в pg_stat_activity.
-		if _, err := conn.Exec(ctx, "set application_name = 'pgxpool-demo'"); err != nil {
+		// Настройка сессии (WithSessionInit) — до подготовки выражений и до снимка параметров.
+		if err := initSession(ctx, conn.PgConn(), o.sessionInit); err != nil {
 			return err
 		}
-
+		// Исходные параметры сессии — точка отсчёта для HealthPolicy (без WithHealthPolicy ничего не делает).
+		o.health.connected(conn)
+		// То же для сброса сессии (WithSessionReset): исходный application_name.
+		o.reset.connected(conn)
+		// application_name уже пришёл стартовым параметром соединения (см. WithAppName).
 		// Готовим ключевые выражения. Подготовленное выражение привязано к КОНКРЕТНОМУ соединению.
 		// Благодаря AfterConnect мы гарантируем, что каждое соединение пула его имеет.
-		if _, err := conn.Prepare(ctx, psInsertUser,
-			`INSERT INTO app_users(email, name, middle_name)
-			 VALUES ($1,$2,$3)
-			 ON CONFLICT (email) DO UPDATE SET name = EXCLUDED.name
-			 RETURNING id`); err != nil {
-			return err
-		}
-		if _, err := conn.Prepare(ctx, psSetLastLogin,
-			`UPDATE app_users SET last_login = now() WHERE id = $1`); err != nil {
-			return err
-		}
-		if _, err := conn.Prepare(ctx, psGetUserByEmail,
-			`SELECT id, email, name, middle_name, last_login, is_active
-			   FROM app_users
-			  WHERE email = $1`); err != nil {
-			return err
-		}
-		if _, err := conn.Prepare(ctx, psEnsureAccount,
-			`INSERT INTO accounts(user_id, balance)
-			 VALUES ($1, 0)
-			 ON CONFLICT (user_id) DO NOTHING`); err != nil {
-			return err
-		}
-		if _, err := conn.Prepare(ctx, psGetBalance,
-			`SELECT balance FROM accounts WHERE user_id = $1`); err != nil {
-			return err
-		}
-		if _, err := conn.Prepare(ctx, psSelectUsersLight,
-			`SELECT id, email, name FROM app_users ORDER BY id LIMIT 5`); err != nil {
-			return err
-		}
-		if _, err := conn.Prepare(ctx, psGetUserIdByEmail,
-			`SELECT id FROM app_users WHERE email = $1`); err != nil {
-			return err
-		}
-		// Prepared для вставки/чтения из таблицы демонстрации типов (type_samples)
-		if _, err := conn.Prepare(ctx, psInsertTypeSample,
-			`INSERT INTO type_samples(uid, i2, i4, i8, flag, note, num, ts)
-			 VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
-			 RETURNING id`); err != nil {
-			return err
-		}
-		if _, err := conn.Prepare(ctx, psGetTypeSample,
-			`SELECT uid, i2, i4, i8, flag, note, num, ts
-			   FROM type_samples
-			  WHERE id = $1`); err != nil {
-			return err
-		}
-		return nil
+		return Statements.PrepareAll(ctx, conn)
 	}
 
 	// Хук BeforeAcquire — можно добавить легкие проверки/фильтры перед выдачей соединения.
 	cfg.BeforeAcquire = func(ctx context.Context, conn *pgx.Conn) bool {
 		// Возвращаем true — «соединение годится».
-		// Здесь можно, например, проверять свойства сессии.
-		return true
+		// Здесь можно, например, проверять свойства сессии (см. WithFailover: pg_is_in_recovery()).
+		return o.health.healthy(conn)
 	}
 
 	// Хук AfterRelease — трекинг/логирование момента возврата.
 	cfg.AfterRelease = func(conn *pgx.Conn) bool {
 		// Возвращаем true — «соединение оставить в пуле».
-		// Можно вернуть false, если хотим закрыть это соединение (например, заметили подозрительное состояние).
-		return true
+		// Можно вернуть false, если хотим закрыть это соединение (например, заметили подозрительное состояние):
+		// так делает HealthPolicy (WithHealthPolicy) — изменённые GUC, лимит запросов, фатальная ошибка.
+		// Сброс сессии (WithSessionReset) — раньше политики: очищенная сессия уже не «изменена».
+		if !o.reset.release(conn, o.sessionInit) {
+			return false
+		}
+		return o.health.healthy(conn)
+	}
+
+	// Проверка primary для multi-host DSN (WithFailover) — раньше пользовательских хуков:
+	// соединение со standby отбрасывается до того, как им займутся остальные.
+	hooks := o.hooks
+	if o.failover != nil {
+		m, err := newFailoverMonitor(cfg, dsn, *o.failover)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append([]Hooks{m.hooks()}, hooks...)
 	}
 
-	// Итог: cfg содержит как ConnConfig (настройка одного соединения),
-	// так и параметры пула (лимиты/хуки/политики возраста-простоя).
+	// Пользовательские хуки (WithHooks) выполняются после встроенных.
+	applyHooks(cfg, hooks)
+	// Трассировка пула/запросов (WithMetrics, WithTracer, WithHealthPolicy).
+	applyTracers(cfg, o)
+	return cfg, nil
+}
+
+// BuildPool: BuildPoolConfig + NewWithConfig.
+// Итог: cfg содержит как ConnConfig (настройка одного соединения),
+// так и параметры пула (лимиты/хуки/политики возраста-простоя).
+func BuildPool(ctx context.Context, dsn string, opts ...PoolOption) (*pgxpool.Pool, error) {
+	cfg, err := BuildPoolConfig(dsn, opts...)
+	if err != nil {
+		return nil, err
+	}
 	pool, err := pgxpool.NewWithConfig(ctx, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("NewWithConfig: %w", err)
@@ -182,55 +135,19 @@ func BuildPool(ctx context.Context, dsn string) (*pgxpool.Pool, error) {
 	return pool, nil
 }
 
-// ensureSchema — создаем минимальную схему для примеров.
+// ensureSchema — применяем миграции через соединение из пула (тот же раннер, что и у bootstrap).
 func EnsureSchema(ctx context.Context, pool *pgxpool.Pool) error {
-	ddl := []string{
-		`CREATE TABLE IF NOT EXISTS app_users (
-			id          BIGSERIAL PRIMARY KEY,
-			email       TEXT UNIQUE NOT NULL,
-			name        TEXT NOT NULL,
-			middle_name TEXT,
-			last_login  TIMESTAMPTZ,
-			is_active   BOOLEAN NOT NULL DEFAULT TRUE
-		)`,
-		`CREATE TABLE IF NOT EXISTS accounts (
-			user_id BIGINT PRIMARY KEY REFERENCES app_users(id) ON DELETE CASCADE,
-			balance NUMERIC(12,2) NOT NULL
-		)`,
-		// Таблица под демонстрацию типов и NULL — аналогично bootstrap
-		`CREATE TABLE IF NOT EXISTS type_samples (
-			id   BIGSERIAL PRIMARY KEY,
-			uid  UUID,
-			i2   SMALLINT,
-			i4   INTEGER,
-			i8   BIGINT,
-			flag BOOLEAN,
-			note TEXT,
-			num  NUMERIC(12,2),
-			ts   TIMESTAMPTZ
-		)`,
-	}
-	for _, q := range ddl {
-		if _, err := pool.Exec(ctx, q); err != nil {
-			return err
-		}
-	}
-	return nil
+	return Migrations.MigratePool(ctx, pool)
 }
 
 // upsertUserAndLogLogin — реальный шаблон работы с транзакцией:
 // 1) UPSERT пользователя (email — естественный уникальный ключ).
 // 2) Логируем вход (обновляем last_login).
 // Все методы Tx принимают context — это важно для таймаутов и отмены.
+// Begin/Rollback/Commit берёт на себя WithTx; UPSERT идемпотентен, поэтому повтор по DefaultRetryPolicy безопасен.
 func UpsertUserAndLogLogin(ctx context.Context, pool *pgxpool.Pool, email, name string, middleName *string) (int64, error) {
-	tx, err := pool.Begin(ctx)
-	if err != nil {
-		return 0, err
-	}
-	defer tx.Rollback(ctx) // безопасно вызвать повторно — откатится только если не был Commit
-
 	// Подготовленные выражения, сделанные в AfterConnect, доступны и из tx:
-	// Вызов tx.QueryRow(ctx, "ps_name", ...) — это ВЫЗОВ ПО ИМЕНИ prepared-statement.
+	// psInsertUser.QueryRow(ctx, tx, ...) == tx.QueryRow(ctx, "ps_insert_user", ...) — это ВЫЗОВ ПО ИМЕНИ prepared-statement.
 	var mid pgtype.Text
 	if middleName != nil {
 		mid = pgtype.Text{String: *middleName, Valid: true}
@@ -239,32 +156,31 @@ func UpsertUserAndLogLogin(ctx context.Context, pool *pgxpool.Pool, email, name
 	}
 
 	var userID int64
-	if err := tx.QueryRow(ctx, psInsertUser, email, name, mid).Scan(&userID); err != nil {
-		return 0, err
-	}
-
-	if _, err := tx.Exec(ctx, psSetLastLogin, userID); err != nil {
-		return 0, err
-	}
-
-	// Важно: Commit/rollback возвращают соединение в пул.
-	if err := tx.Commit(ctx); err != nil {
-		return 0, err
+	err := WithTx(ctx, pool, TxOptions{Retry: DefaultRetryPolicy}, func(tx pgx.Tx) error {
+		if err := psInsertUser.QueryRow(ctx, tx, email, name, mid).Scan(&userID); err != nil {
+			return err
+		}
+		_, err := psSetLastLogin.Exec(ctx, tx, userID)
+		return err
+	})
+	if err != nil {
+		// Классифицированная ошибка: errors.Is(err, pgerr.ErrUniqueViolation) и т.п. — удобно маппить в HTTP-ответ.
+		return 0, pgerr.Classify(err)
 	}
 	return userID, nil
 }
 
 // ensureAccount — «лениво» создаем счет при первом заходе пользователя.
 func EnsureAccount(ctx context.Context, pool *pgxpool.Pool, userID int64) error {
-	_, err := pool.Exec(ctx, psEnsureAccount, userID)
-	return err
+	_, err := psEnsureAccount.Exec(ctx, pool, userID)
+	return pgerr.Classify(err)
 }
 
 // getBalance — читаем NUMERIC в pgtype.Numeric для корректной работы с точностью/NaN/Inf.
 func GetBalance(ctx context.Context, pool *pgxpool.Pool, userID int64) (pgtype.Numeric, error) {
 	var n pgtype.Numeric
-	if err := pool.QueryRow(ctx, psGetBalance, userID).Scan(&n); err != nil {
-		return pgtype.Numeric{}, err
+	if err := psGetBalance.QueryRow(ctx, pool, userID).Scan(&n); err != nil {
+		return pgtype.Numeric{}, pgerr.Classify(err)
 	}
 	if !n.Valid {
 		return pgtype.Numeric{}, errors.New("balance is NULL — для примера считаем это ошибкой")
@@ -276,6 +192,8 @@ func GetBalance(ctx context.Context, pool *pgxpool.Pool, userID int64) (pgtype.N
 // Показывает: Acquire → работа с *pgxpool.Conn → Release.
 // Если соединение «подвисло», логика выдачи в пуле может решить, что его нужно пинговать
 // (внутренняя ShouldPing) или вовсе уничтожить и взять другое.
+// SET, выполненный на таком соединении, достанется следующему владельцу — если только пул
+// не собран с WithSessionReset (сброс сессии при возврате).
 func SampleAcquireRelease(ctx context.Context, pool *pgxpool.Pool) error {
 	c, err := pool.Acquire(ctx)
 	if err != nil {
@@ -293,44 +211,33 @@ func SampleAcquireRelease(ctx context.Context, pool *pgxpool.Pool) error {
 }
 
 // demoScanWithPgtype — демонстрация сканирования с pgtype.* и проверкой Valid (NULL-safe).
+// Строка маппится в User по именам колонок (db-теги), а не по позиции — см. rowmap.go.
 func DemoScanWithPgtype(ctx context.Context, pool *pgxpool.Pool, email string) error {
 	// Получим данные по пользователю с использованием prepared-select.
-	var (
-		id         int64
-		em         string
-		name       string
-		middleName pgtype.Text      // NULL-safe текст
-		lastLogin  pgtype.Timestamp // NULL-safe timestamp с поддержкой InfinityModifier
-		isActive   pgtype.Bool
-	)
-	if err := pool.QueryRow(ctx, psGetUserByEmail, email).
-		Scan(&id, &em, &name, &middleName, &lastLogin, &isActive); err != nil {
+	u, err := CollectOneStruct[User](psGetUserByEmail.Query(ctx, pool, email))
+	if err != nil {
 		return err
 	}
 
 	// Проверяем Valid — если false, в БД был NULL.
 	mid := "NULL"
-	if middleName.Valid {
-		mid = middleName.String
+	if u.MiddleName.Valid { // NULL-safe текст
+		mid = u.MiddleName.String
 	}
 	ll := "NULL"
-	if lastLogin.Valid {
-		ll = lastLogin.Time.Format(time.RFC3339)
-	}
-	act := "NULL"
-	if isActive.Valid {
-		act = fmt.Sprintf("%v", isActive.Bool)
+	if u.LastLogin.Valid { // NULL-safe timestamptz с поддержкой InfinityModifier
+		ll = u.LastLogin.Time.Format(time.RFC3339)
 	}
 
-	log.Printf("User: id=%d email=%s name=%s middle_name=%s last_login=%s is_active=%s",
-		id, em, name, mid, ll, act)
+	log.Printf("User: id=%d email=%s name=%s middle_name=%s last_login=%s is_active=%v",
+		u.ID, u.Email, u.Name, mid, ll, u.IsActive)
 	return nil
 }
 
 // showQueryMetadata — получение метаданных результата.
 // Rows.FieldDescriptions() возвращает срез pgconn.FieldDescription (имя колонки, OID типа и т.д.).
 func ShowQueryMetadata(ctx context.Context, pool *pgxpool.Pool) error {
-	rows, err := pool.Query(ctx, psSelectUsersLight)
+	rows, err := psSelectUsersLight.Query(ctx, pool)
 	if err != nil {
 		return err
 	}
@@ -372,15 +279,16 @@ func ShowQueryMetadata(ctx context.Context, pool *pgxpool.Pool) error {
 
 // TypeSample — компактная модель строки из таблицы type_samples.
 // ВАЖНО: каждый тип реализован через pgtype.* с флагом Valid: если Valid=false → в БД пишется/читается NULL.
+// Теги db задают имя колонки для RowToStructByName — порядок колонок в SELECT не важен.
 type TypeSample struct {
-	UUID pgtype.UUID
-	I2   pgtype.Int2
-	I4   pgtype.Int4
-	I8   pgtype.Int8
-	Flag pgtype.Bool
-	Note pgtype.Text
-	Num  pgtype.Numeric
-	TS   pgtype.Timestamp
+	UUID pgtype.UUID      `db:"uid"`
+	I2   pgtype.Int2      `db:"i2"`
+	I4   pgtype.Int4      `db:"i4"`
+	I8   pgtype.Int8      `db:"i8"`
+	Flag pgtype.Bool      `db:"flag"`
+	Note pgtype.Text      `db:"note"`
+	Num  pgtype.Numeric   `db:"num"`
+	TS   pgtype.Timestamp `db:"ts"`
 }
 
 // InsertTypeSample — демонстрация записи значений разных типов (включая NULL через Valid=false).
@@ -388,51 +296,45 @@ type TypeSample struct {
 func InsertTypeSample(ctx context.Context, pool *pgxpool.Pool, s TypeSample) (int64, error) {
 	var id int64
 	// Пишем строго через pgtype.* — они корректно кодируют NULL/значения и точность Numeric.
-	if err := pool.QueryRow(ctx, psInsertTypeSample,
+	if err := psInsertTypeSample.QueryRow(ctx, pool,
 		s.UUID, s.I2, s.I4, s.I8, s.Flag, s.Note, s.Num, s.TS,
 	).Scan(&id); err != nil {
-		return 0, err
+		return 0, pgerr.Classify(err)
 	}
 	return id, nil
 }
 
 // GetTypeSample — чтение той же строки и демонстрация проверки Valid для каждого поля.
 func GetTypeSample(ctx context.Context, pool *pgxpool.Pool, id int64) (TypeSample, error) {
-	var out TypeSample
-	if err := pool.QueryRow(ctx, psGetTypeSample, id).
-		Scan(&out.UUID, &out.I2, &out.I4, &out.I8, &out.Flag, &out.Note, &out.Num, &out.TS); err != nil {
-		return TypeSample{}, err
+	out, err := CollectOneStruct[TypeSample](psGetTypeSample.Query(ctx, pool, id))
+	if err != nil {
+		return TypeSample{}, pgerr.Classify(err)
 	}
 	return out, nil
 }
 
 // TxQueryExample — пример выборки внутри транзакции через tx.Query (итерация по Rows).
 // Показываем правильное закрытие курсора, rows.Err() и фиксацию транзакции.
+// Транзакция только на чтение: WithTx передаёт AccessMode в BEGIN.
 func TxQueryExample(ctx context.Context, pool *pgxpool.Pool) error {
-	tx, err := pool.Begin(ctx)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback(ctx)
-
-	rows, err := tx.Query(ctx, psSelectUsersLight)
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var id int64
-		var email, name string
-		if err := rows.Scan(&id, &email, &name); err != nil {
+	opts := TxOptions{TxOptions: pgx.TxOptions{AccessMode: pgx.ReadOnly}}
+	return WithTx(ctx, pool, opts, func(tx pgx.Tx) error {
+		rows, err := psSelectUsersLight.Query(ctx, tx)
+		if err != nil {
 			return err
 		}
-		log.Printf("tx.query row: id=%d email=%s name=%s", id, email, name)
-	}
-	if err := rows.Err(); err != nil {
-		return err
-	}
-	return tx.Commit(ctx)
+		defer rows.Close()
+
+		for rows.Next() {
+			var id int64
+			var email, name string
+			if err := rows.Scan(&id, &email, &name); err != nil {
+				return err
+			}
+			log.Printf("tx.query row: id=%d email=%s name=%s", id, email, name)
+		}
+		return rows.Err()
+	})
 }
 
 // ShowPreparedStatementMetadata — демонстрация получения метаданных prepared‑выражения без выполнения запроса.
@@ -464,6 +366,7 @@ func ShowPreparedStatementMetadata(ctx context.Context, pool *pgxpool.Pool) erro
 
 // DemoPgErrorHandling — пример идиоматичной обработки ошибок Postgres через *pgconn.PgError.
 // Создадим уникальное нарушение (23505) на app_users.email с помощью явного INSERT без ON CONFLICT.
+// Дальше — то же самое через классификацию pgerr: sentinel-класс + детали без разбора SQLSTATE вручную.
 func DemoPgErrorHandling(ctx context.Context, pool *pgxpool.Pool, email string) error {
 	// Нарочно пытаемся вставить уже существующий email, чтобы поймать 23505 unique_violation
 	_, err := pool.Exec(ctx,
@@ -478,6 +381,13 @@ func DemoPgErrorHandling(ctx context.Context, pool *pgxpool.Pool, email string)
 		// Код и краткая диагностика от сервера — полезно для ветвления логики и алертов.
 		log.Printf("PgError caught: code=%s (%s) message=%s detail=%s constraint=%s",
 			pge.Code, pge.Severity, pge.Message, pge.Detail, pge.ConstraintName)
+
+		err = pgerr.Classify(err)
+		var ce *pgerr.Error
+		if errors.Is(err, pgerr.ErrUniqueViolation) && errors.As(err, &ce) {
+			log.Printf("pgerr: unique violation on %s.%s (retryable=%v transient=%v)",
+				ce.Table, ce.Constraint, pgerr.IsRetryable(err), pgerr.IsTransient(err))
+		}
 		return nil
 	}
 	// Если это не PgError — пробрасываем дальше.
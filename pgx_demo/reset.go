@@ -0,0 +1,185 @@
+// Сброс состояния сессии при возврате соединения в пул (семантика DISCARD ALL без DEALLOCATE ALL).
+// Вызывающий код с ручным Acquire (см. SampleAcquireRelease) может выполнить SET search_path,
+// SET statement_timeout, SET ROLE, LISTEN или взять advisory-блокировку — и всё это достанется
+// следующему владельцу соединения. WithSessionReset включает очистку в AfterRelease.
+//
+// Prepared-выражения из AfterConnect (реестр Statements) не трогаем: DEALLOCATE ALL заставил бы
+// готовить их заново, а DISCARD ALL ещё и сбросил бы их вместе с планами.
+// application_name переживает RESET ALL, если он пришёл стартовым параметром (WithAppName);
+// если же значение сессии отличается от исходного, оно восстанавливается явно.
+
+package pgx_demo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DefaultSessionResetSQL — DISCARD ALL без DEALLOCATE ALL и DISCARD PLANS.
+// Выполняется одним simple-protocol запросом, поэтому не может идти внутри транзакции —
+// а соединение с открытой транзакцией pgxpool закрывает ещё до AfterRelease.
+const DefaultSessionResetSQL = `CLOSE ALL;
+SET SESSION AUTHORIZATION DEFAULT;
+RESET ALL;
+UNLISTEN *;
+SELECT pg_advisory_unlock_all();
+DISCARD TEMP;
+DISCARD SEQUENCES`
+
+// ResetMode — когда выполнять сброс.
+type ResetMode int
+
+const (
+	// ResetAlways — при каждом возврате соединения: лишний round-trip на каждый pool.Query/Exec.
+	ResetAlways ResetMode = iota
+	// ResetIfChanged — только если на соединении выполнялся SET/RESET/set_config(..., false)
+	// или изменился reported-параметр. LISTEN, advisory-блокировки и временные таблицы так не видны.
+	ResetIfChanged
+)
+
+// SessionReset — настройки сброса для WithSessionReset. Нулевое значение — ResetAlways с DefaultSessionResetSQL.
+type SessionReset struct {
+	Mode ResetMode
+	// SQL — команды очистки; пусто — DefaultSessionResetSQL. Несколько команд через ';'.
+	SQL string
+	// Timeout — предел на сброс; не уложились — соединение закрывается. По умолчанию 5s.
+	Timeout time.Duration
+}
+
+const defaultSessionResetTimeout = 5 * time.Second
+
+// WithSessionReset — очищать состояние сессии при возврате соединения в пул.
+// Соединение, на котором сброс не удался, закрывается, а не возвращается.
+func WithSessionReset(r SessionReset) PoolOption {
+	return func(o *poolOptions) {
+		s := newSessionResetter(r)
+		o.reset = s
+		o.queryTracers = append(o.queryTracers, s)
+	}
+}
+
+// sessionResetter — реализация WithSessionReset: хуки + трассировщик для ResetIfChanged.
+type sessionResetter struct {
+	opts SessionReset
+}
+
+func newSessionResetter(r SessionReset) *sessionResetter {
+	if r.SQL == "" {
+		r.SQL = DefaultSessionResetSQL
+	}
+	if r.Timeout <= 0 {
+		r.Timeout = defaultSessionResetTimeout
+	}
+	return &sessionResetter{opts: r}
+}
+
+// resetKey — ключ состояния в pgconn.PgConn.CustomData().
+const resetKey = "pgx_demo.reset"
+
+// resetState — что известно о сессии: исходные параметры и признак изменения.
+type resetState struct {
+	appName string
+	params  map[string]string // trackedParams на момент подключения
+	dirty   bool
+	pending bool
+}
+
+// connected — AfterConnect: запоминаем application_name и reported-параметры.
+func (s *sessionResetter) connected(conn *pgx.Conn) {
+	if s == nil {
+		return
+	}
+	pc := conn.PgConn()
+	st := &resetState{appName: pc.ParameterStatus("application_name"), params: make(map[string]string, len(trackedParams))}
+	for _, k := range trackedParams {
+		st.params[k] = pc.ParameterStatus(k)
+	}
+	pc.CustomData()[resetKey] = st
+}
+
+// needed — нужен ли сброс соединению в состоянии st.
+func (s *sessionResetter) needed(st *resetState, param func(string) string) bool {
+	if s.opts.Mode == ResetAlways || st == nil {
+		return true
+	}
+	return st.dirty || paramsChanged(st.params, param)
+}
+
+// release — AfterRelease: false закрывает соединение. nil — сброс выключен.
+// init — команды WithSessionInit: RESET ALL откатывает и их, поэтому они выполняются заново.
+func (s *sessionResetter) release(conn *pgx.Conn, init []string) bool {
+	if s == nil {
+		return true
+	}
+	pc := conn.PgConn()
+	st, _ := pc.CustomData()[resetKey].(*resetState)
+	if !s.needed(st, pc.ParameterStatus) {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.Timeout)
+	defer cancel()
+	return s.reset(ctx, conn, st, init) == nil
+}
+
+// reset — команды очистки через pgconn, мимо трассировщиков: сам RESET не должен выглядеть
+// как изменение сессии ни для ResetIfChanged, ни для HealthPolicy.
+func (s *sessionResetter) reset(ctx context.Context, conn *pgx.Conn, st *resetState, init []string) error {
+	pc := conn.PgConn()
+	if _, err := pc.Exec(ctx, s.opts.SQL).ReadAll(); err != nil {
+		return fmt.Errorf("session reset: %w", err)
+	}
+	if err := initSession(ctx, pc, init); err != nil {
+		return fmt.Errorf("session reset: %w", err)
+	}
+	if st == nil {
+		return nil
+	}
+	if pc.ParameterStatus("application_name") != st.appName {
+		const restore = `SELECT set_config('application_name', $1, false)`
+		if _, err := pc.ExecParams(ctx, restore, [][]byte{[]byte(st.appName)}, nil, nil, nil).Close(); err != nil {
+			return fmt.Errorf("session reset: restore application_name: %w", err)
+		}
+	}
+	st.dirty = false
+	if h, ok := pc.CustomData()[healthKey].(*connHealth); ok {
+		h.gucDirty = false
+	}
+	return nil
+}
+
+// TraceQueryStart/TraceQueryEnd и Batch* — отмечаем сессию изменённой после успешного SET/RESET.
+func (s *sessionResetter) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if st, ok := conn.PgConn().CustomData()[resetKey].(*resetState); ok {
+		st.pending = changesSessionGUC(data.SQL)
+	}
+	return ctx
+}
+
+func (s *sessionResetter) TraceQueryEnd(_ context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	if st, ok := conn.PgConn().CustomData()[resetKey].(*resetState); ok {
+		st.observe(data.Err)
+	}
+}
+
+func (s *sessionResetter) TraceBatchStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceBatchStartData) context.Context {
+	return ctx
+}
+
+func (s *sessionResetter) TraceBatchQuery(_ context.Context, conn *pgx.Conn, data pgx.TraceBatchQueryData) {
+	if st, ok := conn.PgConn().CustomData()[resetKey].(*resetState); ok {
+		st.pending = changesSessionGUC(data.SQL)
+		st.observe(data.Err)
+	}
+}
+
+func (s *sessionResetter) TraceBatchEnd(context.Context, *pgx.Conn, pgx.TraceBatchEndData) {}
+
+func (st *resetState) observe(err error) {
+	if st.pending && err == nil {
+		st.dirty = true
+	}
+	st.pending = false
+}
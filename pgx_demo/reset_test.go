@@ -0,0 +1,81 @@
+package pgx_demo
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/multitracer"
+)
+
+func TestSessionResetDefaults(t *testing.T) {
+	s := newSessionResetter(SessionReset{})
+	if s.opts.SQL != DefaultSessionResetSQL || s.opts.Timeout != defaultSessionResetTimeout || s.opts.Mode != ResetAlways {
+		t.Fatalf("defaults = %+v", s.opts)
+	}
+	custom := newSessionResetter(SessionReset{Mode: ResetIfChanged, SQL: "RESET ALL", Timeout: time.Second})
+	if custom.opts.SQL != "RESET ALL" || custom.opts.Timeout != time.Second {
+		t.Fatalf("custom = %+v", custom.opts)
+	}
+
+	// Prepared-выражения из AfterConnect должны пережить сброс.
+	upper := strings.ToUpper(DefaultSessionResetSQL)
+	for _, banned := range []string{"DEALLOCATE", "DISCARD ALL", "DISCARD PLANS"} {
+		if strings.Contains(upper, banned) {
+			t.Errorf("DefaultSessionResetSQL contains %s", banned)
+		}
+	}
+}
+
+func TestSessionResetNeeded(t *testing.T) {
+	params := map[string]string{"search_path": "public"}
+	param := func(k string) string { return params[k] }
+	fresh := func() *resetState {
+		return &resetState{params: map[string]string{"search_path": "public"}}
+	}
+
+	always := newSessionResetter(SessionReset{})
+	if !always.needed(fresh(), param) {
+		t.Error("ResetAlways must reset a clean session")
+	}
+
+	changed := newSessionResetter(SessionReset{Mode: ResetIfChanged})
+	if changed.needed(fresh(), param) {
+		t.Error("ResetIfChanged reset a clean session")
+	}
+	if !changed.needed(nil, param) {
+		t.Error("unknown session state must be reset")
+	}
+
+	st := fresh()
+	st.pending = changesSessionGUC("SET statement_timeout = '1s'")
+	st.observe(nil)
+	if !changed.needed(st, param) {
+		t.Error("SET not noticed")
+	}
+
+	st = fresh()
+	params["search_path"] = "tenant_1"
+	if !changed.needed(st, param) {
+		t.Error("changed reported parameter not noticed")
+	}
+}
+
+func TestWithSessionResetWiring(t *testing.T) {
+	cfg, err := BuildPoolConfig("postgres://u:p@localhost/app", WithSessionReset(SessionReset{Mode: ResetIfChanged}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mt, ok := cfg.ConnConfig.Tracer.(*multitracer.Tracer)
+	if !ok || len(mt.QueryTracers) != 1 || len(mt.BatchTracers) != 1 {
+		t.Fatalf("tracer = %#v, want resetter as query and batch tracer", cfg.ConnConfig.Tracer)
+	}
+	if cfg.AfterRelease == nil {
+		t.Fatal("AfterRelease not set")
+	}
+
+	var off *sessionResetter
+	if !off.release(nil, nil) {
+		t.Error("disabled reset must keep the conn")
+	}
+}
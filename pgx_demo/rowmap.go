@@ -0,0 +1,65 @@
+// Маппинг строк в структуры по имени колонки (db:"..." теги) вместо позиционного Scan.
+// Перестановка колонок в SELECT больше ничего не ломает, а расхождение «структура ↔ запрос»
+// ловится при старте: StatementRegistry.Validate сверяет поля структуры с FieldDescriptions() выражения.
+
+package pgx_demo
+
+import (
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// CollectStructs — все строки в []T по именам колонок (pgx.RowToStructByName).
+// err — ошибка самого Query: так удобно писать CollectStructs[T](stmt.Query(ctx, q, args...)).
+func CollectStructs[T any](rows pgx.Rows, err error) ([]T, error) {
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByName[T])
+}
+
+// CollectOneStruct — ровно одна строка в T; нет строк — pgx.ErrNoRows.
+func CollectOneStruct[T any](rows pgx.Rows, err error) (T, error) {
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[T])
+}
+
+// ExpectRow регистрирует проверку: колонки результата s должны один-в-один совпадать с полями T
+// (по тем же правилам, что и RowToStructByName). Проверка выполняется в r.Validate.
+// Возвращает s, чтобы оборачивать объявление: psX = ExpectRow[T](Statements, Statements.MustRegister(...)).
+func ExpectRow[T any](r *StatementRegistry, s Stmt) Stmt {
+	r.rowChecks[s.name] = append(r.rowChecks[s.name], CheckRowMapping[T])
+	return s
+}
+
+// CheckRowMapping — сверка полей T с описанием колонок без реальных данных.
+// Используем сам pgx.RowToStructByName на «пустой» строке: правила сопоставления
+// (теги db, регистр, "_", db:"-", встроенные структуры) гарантированно те же, что в рантайме.
+func CheckRowMapping[T any](fields []pgconn.FieldDescription) error {
+	if _, err := pgx.RowToStructByName[T](mappingProbeRow(fields)); err != nil {
+		var zero T
+		return fmt.Errorf("row mapping %T: %w", zero, err)
+	}
+	return nil
+}
+
+// mappingProbeRow — CollectableRow без данных: только FieldDescriptions, Scan ничего не пишет.
+type mappingProbeRow []pgconn.FieldDescription
+
+func (r mappingProbeRow) FieldDescriptions() []pgconn.FieldDescription { return r }
+
+func (r mappingProbeRow) Scan(dest ...any) error {
+	if len(dest) != len(r) {
+		return fmt.Errorf("got %d scan targets for %d columns", len(dest), len(r))
+	}
+	return nil
+}
+
+func (r mappingProbeRow) Values() ([]any, error) { return nil, nil }
+
+func (r mappingProbeRow) RawValues() [][]byte { return nil }
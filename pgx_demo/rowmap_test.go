@@ -0,0 +1,53 @@
+package pgx_demo
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func fields(names ...string) []pgconn.FieldDescription {
+	out := make([]pgconn.FieldDescription, len(names))
+	for i, n := range names {
+		out[i] = pgconn.FieldDescription{Name: n}
+	}
+	return out
+}
+
+func TestCheckRowMapping(t *testing.T) {
+	ok := [][]pgconn.FieldDescription{
+		fields("id", "email", "name", "middle_name", "last_login", "is_active"),
+		// Порядок колонок не важен — сопоставление по именам.
+		fields("is_active", "last_login", "middle_name", "name", "email", "id"),
+	}
+	for _, f := range ok {
+		if err := CheckRowMapping[User](f); err != nil {
+			t.Errorf("CheckRowMapping(%v) = %v, want nil", f, err)
+		}
+	}
+
+	bad := map[string][]pgconn.FieldDescription{
+		"missing column": fields("id", "email", "name", "middle_name", "last_login"),
+		"extra column":   fields("id", "email", "name", "middle_name", "last_login", "is_active", "created_at"),
+		"renamed column": fields("id", "mail", "name", "middle_name", "last_login", "is_active"),
+	}
+	for name, f := range bad {
+		if err := CheckRowMapping[User](f); err == nil {
+			t.Errorf("%s: CheckRowMapping = nil, want error", name)
+		}
+	}
+
+	if err := CheckRowMapping[TypeSample](fields("uid", "i2", "i4", "i8", "flag", "note", "num", "ts")); err != nil {
+		t.Errorf("TypeSample: %v", err)
+	}
+}
+
+func TestPackageRowChecksRegistered(t *testing.T) {
+	for _, name := range []string{
+		"ps_get_user_by_email", "ps_get_user_by_id", "ps_list_users", "ps_update_user", "ps_get_type_sample",
+	} {
+		if len(Statements.rowChecks[name]) == 0 {
+			t.Errorf("statement %s has no row mapping check", name)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+// Корректное завершение пула. pool.Close() закрывает простаивающие соединения, отклоняет новые Acquire
+// и ждёт возврата выданных — сколько угодно долго и молча. ShutdownTracker добавляет срок и видимость:
+//  1. pool.Close() в фоне — новые Acquire сразу получают ошибку закрытого пула;
+//  2. до дедлайна ctx ждём, пока начатые транзакции завершатся и соединения вернутся;
+//  3. по дедлайну каждому ещё выданному соединению отправляется pgconn.CancelRequest — выполняющийся
+//     запрос получает 57014, транзакция откатывается, соединение возвращается;
+//  4. что было прервано (PID, запрос, сколько выполнялся), пишется в лог и возвращается в отчёте.
+//
+//	sd := NewShutdownTracker(ShutdownOptions{})
+//	pool, _ := BuildPool(ctx, dsn, WithShutdownTracker(sd))
+//	...
+//	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+//	report, err := sd.Shutdown(ctx, pool)
+
+package pgx_demo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrShutdownTimeout — соединения не вернулись даже после отмены запросов (например, приложение
+// держит транзакцию, не выполняя запросов). pool.Close продолжает ждать в фоне.
+var ErrShutdownTimeout = errors.New("pool shutdown timed out")
+
+// ShutdownOptions — настройки ShutdownTracker.
+type ShutdownOptions struct {
+	// CancelGrace — сколько после CancelRequest ждать, пока прерванные запросы вернут соединения. По умолчанию 5s.
+	CancelGrace time.Duration
+	// Logger — куда писать прерванные запросы. nil — slog.Default().
+	Logger *slog.Logger
+}
+
+const defaultCancelGrace = 5 * time.Second
+
+// InflightConn — выданное соединение на момент дедлайна.
+type InflightConn struct {
+	PID  uint32
+	SQL  string        // последний запрос (имя prepared или текст, до maxInflightSQL байт)
+	Held time.Duration // сколько соединение выдано
+	// Running — сколько выполняется текущий запрос; 0 — запрос не выполняется (простой внутри транзакции).
+	Running time.Duration
+}
+
+// ShutdownReport — итог Shutdown.
+type ShutdownReport struct {
+	Waited  time.Duration  // от начала Shutdown до закрытия пула (или до отказа)
+	Aborted []InflightConn // кому отправлен CancelRequest
+}
+
+// Clean — все соединения вернулись до дедлайна, ничего не прервано.
+func (r ShutdownReport) Clean() bool { return len(r.Aborted) == 0 }
+
+// ShutdownTracker — учёт выданных соединений и их текущих запросов, батчей и COPY (как pgxpool.AcquireTracer,
+// pgxpool.ReleaseTracer, pgx.QueryTracer, pgx.BatchTracer и pgx.CopyFromTracer) и сам Shutdown.
+type ShutdownTracker struct {
+	opts ShutdownOptions
+
+	mu    sync.Mutex
+	conns map[*pgx.Conn]*inflight
+
+	now    func() time.Time
+	cancel func(ctx context.Context, conn *pgx.Conn) error // подменяется в тестах
+}
+
+type inflight struct {
+	pid        uint32
+	acquired   time.Time
+	sql        string
+	queryStart time.Time // нулевое — запрос не выполняется
+	batch      []string  // SQL запросов текущего SendBatch
+	batchDone  int       // сколько из них уже вернули результат
+}
+
+// maxInflightSQL — сколько текста запроса сохранять для лога.
+const maxInflightSQL = 200
+
+// NewShutdownTracker — трекер; подключается к пулу через WithShutdownTracker.
+func NewShutdownTracker(opts ShutdownOptions) *ShutdownTracker {
+	if opts.CancelGrace <= 0 {
+		opts.CancelGrace = defaultCancelGrace
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	return &ShutdownTracker{
+		opts:  opts,
+		conns: make(map[*pgx.Conn]*inflight),
+		now:   time.Now,
+		cancel: func(ctx context.Context, conn *pgx.Conn) error {
+			return conn.PgConn().CancelRequest(ctx)
+		},
+	}
+}
+
+// WithShutdownTracker — учитывать выданные соединения пула в s.
+func WithShutdownTracker(s *ShutdownTracker) PoolOption {
+	return WithTracer(s)
+}
+
+// TraceAcquireStart/TraceAcquireEnd — соединение выдано.
+func (s *ShutdownTracker) TraceAcquireStart(ctx context.Context, _ *pgxpool.Pool, _ pgxpool.TraceAcquireStartData) context.Context {
+	return ctx
+}
+
+func (s *ShutdownTracker) TraceAcquireEnd(_ context.Context, _ *pgxpool.Pool, data pgxpool.TraceAcquireEndData) {
+	if data.Err == nil && data.Conn != nil {
+		s.track(data.Conn, data.Conn.PgConn().PID())
+	}
+}
+
+// TraceRelease — соединение возвращено.
+func (s *ShutdownTracker) TraceRelease(_ *pgxpool.Pool, data pgxpool.TraceReleaseData) {
+	s.untrack(data.Conn)
+}
+
+// TraceQueryStart/TraceQueryEnd — текущий запрос соединения.
+func (s *ShutdownTracker) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	s.running(conn, data.SQL)
+	return ctx
+}
+
+func (s *ShutdownTracker) TraceQueryEnd(_ context.Context, conn *pgx.Conn, _ pgx.TraceQueryEndData) {
+	s.done(conn)
+}
+
+// TraceBatchStart/TraceBatchQuery/TraceBatchEnd — SendBatch: соединение занято до конца батча,
+// в SQL — номер и текст первого запроса батча, ещё не вернувшего результат.
+func (s *ShutdownTracker) TraceBatchStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchStartData) context.Context {
+	var queries []string
+	if data.Batch != nil {
+		for _, q := range data.Batch.QueuedQueries {
+			queries = append(queries, q.SQL)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if in, ok := s.conns[conn]; ok {
+		in.batch, in.batchDone = queries, 0
+		in.sql = batchSQL(queries, 0)
+		in.queryStart = s.now()
+	}
+	return ctx
+}
+
+func (s *ShutdownTracker) TraceBatchQuery(_ context.Context, conn *pgx.Conn, _ pgx.TraceBatchQueryData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if in, ok := s.conns[conn]; ok && in.batchDone < len(in.batch) {
+		in.batchDone++
+		if in.batchDone < len(in.batch) {
+			in.sql = batchSQL(in.batch, in.batchDone)
+		}
+	}
+}
+
+func (s *ShutdownTracker) TraceBatchEnd(_ context.Context, conn *pgx.Conn, _ pgx.TraceBatchEndData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if in, ok := s.conns[conn]; ok {
+		in.batch = nil
+		in.queryStart = time.Time{}
+	}
+}
+
+// batchSQL — «batch 2/5: <SQL>» для запроса i батча.
+func batchSQL(queries []string, i int) string {
+	if i >= len(queries) {
+		return fmt.Sprintf("batch of %d", len(queries))
+	}
+	return truncateSQL(fmt.Sprintf("batch %d/%d: %s", i+1, len(queries), queries[i]))
+}
+
+// TraceCopyFromStart/TraceCopyFromEnd — CopyFrom: соединение занято до конца COPY.
+func (s *ShutdownTracker) TraceCopyFromStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceCopyFromStartData) context.Context {
+	s.running(conn, copyFromSQL(data))
+	return ctx
+}
+
+func (s *ShutdownTracker) TraceCopyFromEnd(_ context.Context, conn *pgx.Conn, _ pgx.TraceCopyFromEndData) {
+	s.done(conn)
+}
+
+// running — на conn начал выполняться sql.
+func (s *ShutdownTracker) running(conn *pgx.Conn, sql string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if in, ok := s.conns[conn]; ok {
+		in.sql = truncateSQL(sql)
+		in.queryStart = s.now()
+	}
+}
+
+// done — запрос на conn завершился; SQL остаётся как последний выполненный.
+func (s *ShutdownTracker) done(conn *pgx.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if in, ok := s.conns[conn]; ok {
+		in.queryStart = time.Time{}
+	}
+}
+
+func (s *ShutdownTracker) track(conn *pgx.Conn, pid uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conns[conn] = &inflight{pid: pid, acquired: s.now()}
+}
+
+func (s *ShutdownTracker) untrack(conn *pgx.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+}
+
+// Inflight — выданные сейчас соединения, по убыванию времени выдачи.
+func (s *ShutdownTracker) Inflight() []InflightConn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]InflightConn, 0, len(s.conns))
+	for _, in := range s.conns {
+		out = append(out, s.describe(in))
+	}
+	slices.SortFunc(out, func(a, b InflightConn) int { return int(b.Held - a.Held) })
+	return out
+}
+
+func (s *ShutdownTracker) describe(in *inflight) InflightConn {
+	now := s.now()
+	c := InflightConn{PID: in.pid, SQL: in.sql, Held: now.Sub(in.acquired)}
+	if !in.queryStart.IsZero() {
+		c.Running = now.Sub(in.queryStart)
+	}
+	return c
+}
+
+// Closer — то, что нужно Shutdown от пула (*pgxpool.Pool).
+type Closer interface {
+	Close()
+}
+
+// Shutdown — закрыть пул: ждать выданные соединения до дедлайна ctx, затем отменить их запросы
+// через CancelRequest и ждать ещё CancelGrace. ErrShutdownTimeout — пул так и не закрылся.
+func (s *ShutdownTracker) Shutdown(ctx context.Context, pool Closer) (ShutdownReport, error) {
+	start := s.now()
+	done := make(chan struct{})
+	go func() {
+		pool.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return ShutdownReport{Waited: s.now().Sub(start)}, nil
+	case <-ctx.Done():
+	}
+
+	var report ShutdownReport
+	s.mu.Lock()
+	victims := make(map[*pgx.Conn]InflightConn, len(s.conns))
+	for conn, in := range s.conns {
+		victims[conn] = s.describe(in)
+	}
+	s.mu.Unlock()
+
+	cancelCtx, cancel := context.WithTimeout(context.Background(), s.opts.CancelGrace)
+	defer cancel()
+	for conn, c := range victims {
+		report.Aborted = append(report.Aborted, c)
+		attrs := []any{"pid", c.PID, "stmt", c.SQL, "held", c.Held, "running", c.Running}
+		if err := s.cancel(cancelCtx, conn); err != nil {
+			attrs = append(attrs, "cancel_err", err)
+		}
+		s.opts.Logger.Warn("pgx.shutdown.abort", attrs...)
+	}
+	slices.SortFunc(report.Aborted, func(a, b InflightConn) int { return int(b.Held - a.Held) })
+
+	select {
+	case <-done:
+		report.Waited = s.now().Sub(start)
+		return report, nil
+	case <-cancelCtx.Done():
+		report.Waited = s.now().Sub(start)
+		s.opts.Logger.Error("pgx.shutdown.timeout", "inflight", len(s.Inflight()), "waited", report.Waited)
+		return report, ErrShutdownTimeout
+	}
+}
+
+func truncateSQL(sql string) string {
+	if len(sql) <= maxInflightSQL {
+		return sql
+	}
+	return sql[:maxInflightSQL] + "..."
+}
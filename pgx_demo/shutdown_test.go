@@ -0,0 +1,151 @@
+package pgx_demo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// closerFunc — пул, чей Close ждёт, пока тест не вернёт соединения.
+type closerFunc func()
+
+func (f closerFunc) Close() { f() }
+
+func shutdownHarness(opts ShutdownOptions) (*ShutdownTracker, *bytes.Buffer, *time.Time) {
+	var logs bytes.Buffer
+	opts.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+	s := NewShutdownTracker(opts)
+	now := time.Unix(1000, 0)
+	s.now = func() time.Time { return now }
+	return s, &logs, &now
+}
+
+func TestShutdownTrackerBookkeeping(t *testing.T) {
+	s, _, now := shutdownHarness(ShutdownOptions{})
+	ctx := context.Background()
+	a, b := &pgx.Conn{}, &pgx.Conn{}
+
+	s.track(a, 11)
+	*now = now.Add(time.Second)
+	s.track(b, 22)
+	s.TraceQueryStart(ctx, b, pgx.TraceQueryStartData{SQL: strings.Repeat("x", maxInflightSQL+10)})
+	*now = now.Add(2 * time.Second)
+
+	got := s.Inflight()
+	if len(got) != 2 || got[0].PID != 11 || got[0].Held != 3*time.Second || got[0].Running != 0 {
+		t.Fatalf("Inflight = %+v", got)
+	}
+	if got[1].PID != 22 || got[1].Running != 2*time.Second || len(got[1].SQL) != maxInflightSQL+3 {
+		t.Fatalf("Inflight[1] = %+v", got[1])
+	}
+
+	s.TraceQueryEnd(ctx, b, pgx.TraceQueryEndData{})
+	if got := s.Inflight(); got[1].Running != 0 || got[1].SQL == "" {
+		t.Fatalf("after query end = %+v", got[1])
+	}
+	s.TraceRelease(nil, pgxpool.TraceReleaseData{Conn: a})
+	s.TraceAcquireEnd(ctx, nil, pgxpool.TraceAcquireEndData{Err: errors.New("closed pool")})
+	if got := s.Inflight(); len(got) != 1 || got[0].PID != 22 {
+		t.Fatalf("after release = %+v", got)
+	}
+}
+
+func TestShutdownCleanWhenNothingInflight(t *testing.T) {
+	s, logs, _ := shutdownHarness(ShutdownOptions{})
+	closed := false
+	report, err := s.Shutdown(context.Background(), closerFunc(func() { closed = true }))
+	if err != nil || !closed || !report.Clean() {
+		t.Fatalf("Shutdown = %+v, %v (closed=%v)", report, err, closed)
+	}
+	if logs.Len() != 0 {
+		t.Errorf("clean shutdown must not log, got %q", logs.String())
+	}
+}
+
+func TestShutdownCancelsAfterDeadline(t *testing.T) {
+	s, logs, _ := shutdownHarness(ShutdownOptions{CancelGrace: time.Second})
+	busy, idle := &pgx.Conn{}, &pgx.Conn{}
+	s.track(busy, 7)
+	s.track(idle, 8)
+	s.TraceQueryStart(context.Background(), busy, pgx.TraceQueryStartData{SQL: "SELECT pg_sleep(60)"})
+
+	// Отменённый запрос возвращает соединение — тогда Close завершается.
+	released := make(chan struct{}, 2)
+	var canceled []*pgx.Conn
+	s.cancel = func(_ context.Context, conn *pgx.Conn) error {
+		canceled = append(canceled, conn)
+		s.untrack(conn)
+		released <- struct{}{}
+		return nil
+	}
+	pool := closerFunc(func() { <-released; <-released })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report, err := s.Shutdown(ctx, pool)
+	if err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if len(canceled) != 2 || len(report.Aborted) != 2 || report.Clean() {
+		t.Fatalf("report = %+v, canceled = %d", report, len(canceled))
+	}
+	if !strings.Contains(logs.String(), "pgx.shutdown.abort") || !strings.Contains(logs.String(), "pg_sleep(60)") {
+		t.Errorf("aborted query not logged: %q", logs.String())
+	}
+}
+
+func TestShutdownTimesOutWhenConnsStuck(t *testing.T) {
+	s, logs, _ := shutdownHarness(ShutdownOptions{CancelGrace: 20 * time.Millisecond})
+	s.track(&pgx.Conn{}, 9)
+	s.cancel = func(context.Context, *pgx.Conn) error { return errors.New("cancel refused") }
+
+	stuck := make(chan struct{})
+	defer close(stuck)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report, err := s.Shutdown(ctx, closerFunc(func() { <-stuck }))
+	if !errors.Is(err, ErrShutdownTimeout) || len(report.Aborted) != 1 || report.Aborted[0].PID != 9 {
+		t.Fatalf("Shutdown = %+v, %v", report, err)
+	}
+	if !strings.Contains(logs.String(), "cancel refused") || !strings.Contains(logs.String(), "pgx.shutdown.timeout") {
+		t.Errorf("logs = %q", logs.String())
+	}
+}
+
+func TestShutdownTrackerBatchAndCopy(t *testing.T) {
+	s, _, now := shutdownHarness(ShutdownOptions{})
+	ctx := context.Background()
+	conn := &pgx.Conn{}
+	s.track(conn, 5)
+
+	b := &pgx.Batch{}
+	b.Queue("SELECT 1")
+	b.Queue("SELECT pg_sleep(60)")
+	s.TraceBatchStart(ctx, conn, pgx.TraceBatchStartData{Batch: b})
+	s.TraceBatchQuery(ctx, conn, pgx.TraceBatchQueryData{SQL: "SELECT 1"})
+	*now = now.Add(time.Second)
+	if got := s.Inflight()[0]; got.SQL != "batch 2/2: SELECT pg_sleep(60)" || got.Running != time.Second {
+		t.Fatalf("during batch = %+v", got)
+	}
+	s.TraceBatchQuery(ctx, conn, pgx.TraceBatchQueryData{})
+	s.TraceBatchEnd(ctx, conn, pgx.TraceBatchEndData{})
+	if got := s.Inflight()[0]; got.Running != 0 {
+		t.Fatalf("after batch = %+v", got)
+	}
+
+	s.TraceCopyFromStart(ctx, conn, pgx.TraceCopyFromStartData{TableName: pgx.Identifier{"type_samples"}, ColumnNames: []string{"i4"}})
+	if got := s.Inflight()[0]; got.SQL != `COPY "type_samples" ("i4") FROM STDIN` {
+		t.Fatalf("during copy = %+v", got)
+	}
+	s.TraceCopyFromEnd(ctx, conn, pgx.TraceCopyFromEndData{})
+	if got := s.Inflight()[0]; got.Running != 0 {
+		t.Fatalf("after copy = %+v", got)
+	}
+}
@@ -0,0 +1,340 @@
+// Детектор медленных запросов: SlowQueryDetector — трассировщик запросов, батчей и COPY, который для
+// операций дольше порога сохраняет SQL, имя prepared-выражения, отпечаток аргументов и план EXPLAIN (FORMAT JSON).
+// План снимается асинхронно, по одному запросу за раз, на соединении из того же пула, что выполнил запрос:
+// с его BeforeConnect/AfterConnect (учётные данные, search_path и роль арендатора) и в пределах MaxConns.
+// Пул соединения детектор запоминает сам при выдаче (он же pgxpool.AcquireTracer), а свои EXPLAIN
+// не трассирует (флаг в контексте). При исчерпанном пуле EXPLAIN ждёт соединение не дольше explainTimeout.
+// Последние N образцов — в кольцевом буфере.
+//
+// Подключение:
+//
+//	d := NewSlowQueryDetector(500*time.Millisecond, 100)
+//	defer d.Close()
+//	pool, _ := BuildPool(ctx, dsn, WithTracer(d))
+//	http.Handle("/debug/slow-queries", d)
+
+package pgx_demo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// explainTimeout — предел на получение соединения из пула и EXPLAIN для одного образца.
+	explainTimeout = 5 * time.Second
+	// explainQueueSize — сколько образцов может ждать EXPLAIN; сверх этого план не снимается.
+	explainQueueSize = 16
+)
+
+var (
+	// ErrExplainQueueFull — образец сохранён без плана: очередь EXPLAIN переполнена.
+	ErrExplainQueueFull = errors.New("explain queue full")
+	// ErrNotExplainable — образец сохранён без плана: EXPLAIN для такого выражения не поддерживается
+	// (COPY, служебные команды) или соединение не из пула.
+	ErrNotExplainable = errors.New("statement is not explainable")
+)
+
+// SlowQuerySample — один медленный запрос.
+type SlowQuerySample struct {
+	At              time.Time     `json:"at"`
+	Duration        time.Duration `json:"duration_ns"`
+	StatementName   string        `json:"statement_name,omitempty"`
+	SQL             string        `json:"sql"`
+	ArgsFingerprint string        `json:"args_fingerprint,omitempty"` // sha256 аргументов; сами значения не храним
+	// BatchSize — для SendBatch: сколько запросов в батче. Duration — весь батч, SQL и план — самого долгого запроса.
+	BatchSize int             `json:"batch_size,omitempty"`
+	Err       string          `json:"err,omitempty"` // ошибка самого запроса
+	Plan      json.RawMessage `json:"plan,omitempty"`
+	PlanErr   string          `json:"plan_err,omitempty"`
+}
+
+// SlowQueryDetector — трассировщик медленных запросов. Закрывается через Close.
+type SlowQueryDetector struct {
+	threshold time.Duration
+	reg       *StatementRegistry
+
+	mu     sync.Mutex
+	ring   []SlowQuerySample
+	next   int
+	closed bool
+
+	jobs chan explainJob
+	done chan struct{}
+	// explain — снятие плана; в тестах подменяется.
+	explain func(ctx context.Context, pool *pgxpool.Pool, sql string, args []any) (json.RawMessage, error)
+}
+
+type explainJob struct {
+	sample SlowQuerySample
+	pool   *pgxpool.Pool
+	args   []any
+}
+
+// NewSlowQueryDetector — детектор с порогом threshold, хранящий последние capacity образцов.
+func NewSlowQueryDetector(threshold time.Duration, capacity int) *SlowQueryDetector {
+	d := &SlowQueryDetector{
+		threshold: threshold,
+		reg:       Statements,
+		ring:      make([]SlowQuerySample, 0, max(capacity, 1)),
+		jobs:      make(chan explainJob, explainQueueSize),
+		done:      make(chan struct{}),
+	}
+	d.explain = explainOnPool
+	go d.run()
+	return d
+}
+
+type (
+	slowQueryKey   struct{}
+	slowExplainKey struct{} // EXPLAIN самого детектора — не трассируется
+)
+
+// slowQueryPoolKey — ключ в pgconn.PgConn.CustomData(): пул, которому принадлежит соединение.
+const slowQueryPoolKey = "pgx_demo.slowquery.pool"
+
+type slowQueryStart struct {
+	start time.Time
+	sql   string
+	args  []any
+	// для батча: самый долгий запрос и когда закончился предыдущий
+	batch    int
+	slowest  time.Duration
+	lastDone time.Time
+}
+
+// TraceAcquireStart/TraceAcquireEnd — запоминаем пул соединения: на нём потом снимается план.
+func (d *SlowQueryDetector) TraceAcquireStart(ctx context.Context, _ *pgxpool.Pool, _ pgxpool.TraceAcquireStartData) context.Context {
+	return ctx
+}
+
+func (d *SlowQueryDetector) TraceAcquireEnd(_ context.Context, pool *pgxpool.Pool, data pgxpool.TraceAcquireEndData) {
+	if data.Err != nil || data.Conn == nil {
+		return
+	}
+	if cd := data.Conn.PgConn().CustomData(); cd[slowQueryPoolKey] == nil {
+		cd[slowQueryPoolKey] = pool
+	}
+}
+
+// poolOf — пул, выдавший conn; nil — соединение не из пула.
+func poolOf(conn *pgx.Conn) *pgxpool.Pool {
+	if conn == nil {
+		return nil
+	}
+	pool, _ := conn.PgConn().CustomData()[slowQueryPoolKey].(*pgxpool.Pool)
+	return pool
+}
+
+// TraceQueryStart — запоминаем время начала и запрос.
+func (d *SlowQueryDetector) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if ctx.Value(slowExplainKey{}) != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, slowQueryKey{}, &slowQueryStart{start: time.Now(), sql: data.SQL, args: data.Args})
+}
+
+// TraceQueryEnd — если запрос медленный, ставим его в очередь на EXPLAIN.
+func (d *SlowQueryDetector) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	st, ok := ctx.Value(slowQueryKey{}).(*slowQueryStart)
+	if !ok {
+		return
+	}
+	dur := time.Since(st.start)
+	if dur < d.threshold {
+		return
+	}
+
+	d.record(d.sample(st, dur, data.Err), poolOf(conn), st.args)
+}
+
+// TraceBatchStart/TraceBatchQuery/TraceBatchEnd — медленный SendBatch: время всего батча,
+// план самого долгого запроса (время запроса — от результата предыдущего до его результата).
+func (d *SlowQueryDetector) TraceBatchStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceBatchStartData) context.Context {
+	now := time.Now()
+	return context.WithValue(ctx, slowQueryKey{}, &slowQueryStart{start: now, lastDone: now})
+}
+
+func (d *SlowQueryDetector) TraceBatchQuery(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchQueryData) {
+	st, ok := ctx.Value(slowQueryKey{}).(*slowQueryStart)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	st.batch++
+	if took := now.Sub(st.lastDone); took >= st.slowest {
+		st.slowest, st.sql, st.args = took, data.SQL, data.Args
+	}
+	st.lastDone = now
+}
+
+func (d *SlowQueryDetector) TraceBatchEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchEndData) {
+	st, ok := ctx.Value(slowQueryKey{}).(*slowQueryStart)
+	if !ok {
+		return
+	}
+	dur := time.Since(st.start)
+	if dur < d.threshold {
+		return
+	}
+	s := d.sample(st, dur, data.Err)
+	s.BatchSize = st.batch
+	d.record(s, poolOf(conn), st.args)
+}
+
+// TraceCopyFromStart/TraceCopyFromEnd — медленный CopyFrom; план для COPY не снимается.
+func (d *SlowQueryDetector) TraceCopyFromStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceCopyFromStartData) context.Context {
+	return context.WithValue(ctx, slowQueryKey{}, &slowQueryStart{start: time.Now(), sql: copyFromSQL(data)})
+}
+
+// copyFromSQL — текст COPY, который выполняет CopyFrom (для логов и образцов).
+func copyFromSQL(data pgx.TraceCopyFromStartData) string {
+	cols := make([]string, len(data.ColumnNames))
+	for i, c := range data.ColumnNames {
+		cols[i] = pgx.Identifier{c}.Sanitize()
+	}
+	return fmt.Sprintf("COPY %s (%s) FROM STDIN", data.TableName.Sanitize(), strings.Join(cols, ", "))
+}
+
+func (d *SlowQueryDetector) TraceCopyFromEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceCopyFromEndData) {
+	st, ok := ctx.Value(slowQueryKey{}).(*slowQueryStart)
+	if !ok {
+		return
+	}
+	if dur := time.Since(st.start); dur >= d.threshold {
+		d.record(d.sample(st, dur, data.Err), nil, nil)
+	}
+}
+
+// sample — образец по запомненному запросу.
+func (d *SlowQueryDetector) sample(st *slowQueryStart, dur time.Duration, err error) SlowQuerySample {
+	s := SlowQuerySample{At: st.start, Duration: dur, SQL: st.sql, ArgsFingerprint: argsFingerprint(st.args)}
+	if stmt, found := d.reg.Lookup(st.sql); found {
+		s.StatementName, s.SQL = stmt.Name(), stmt.SQL()
+	}
+	if err != nil {
+		s.Err = err.Error()
+	}
+	return s
+}
+
+// record — сохранить образец; если можно, сначала снять план на соединении из pool.
+func (d *SlowQueryDetector) record(s SlowQuerySample, pool *pgxpool.Pool, args []any) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch {
+	case pool == nil || !explainable(s.SQL):
+		s.PlanErr = ErrNotExplainable.Error()
+	case !d.closed:
+		select {
+		case d.jobs <- explainJob{sample: s, pool: pool, args: args}:
+			return
+		default:
+			s.PlanErr = ErrExplainQueueFull.Error()
+		}
+	default:
+		s.PlanErr = ErrExplainQueueFull.Error()
+	}
+	d.addLocked(s)
+}
+
+// run — единственный потребитель очереди: EXPLAIN выполняются по одному.
+func (d *SlowQueryDetector) run() {
+	defer close(d.done)
+	for job := range d.jobs {
+		ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), slowExplainKey{}, true), explainTimeout)
+		plan, err := d.explain(ctx, job.pool, job.sample.SQL, job.args)
+		cancel()
+		if err != nil {
+			job.sample.PlanErr = err.Error()
+		}
+		job.sample.Plan = plan
+		d.add(job.sample)
+	}
+}
+
+// explainOnPool — EXPLAIN (FORMAT JSON) без ANALYZE: запрос не выполняется, поэтому безопасен и для DML.
+// DescribeExec — без prepared-выражения в кэше соединения: текст EXPLAIN каждый раз новый.
+func explainOnPool(ctx context.Context, pool *pgxpool.Pool, sql string, args []any) (json.RawMessage, error) {
+	var plan []byte
+	qargs := append([]any{pgx.QueryExecModeDescribeExec}, args...)
+	if err := pool.QueryRow(ctx, "EXPLAIN (FORMAT JSON) "+sql, qargs...).Scan(&plan); err != nil {
+		return nil, fmt.Errorf("explain: %w", err)
+	}
+	return plan, nil
+}
+
+func (d *SlowQueryDetector) add(s SlowQuerySample) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.addLocked(s)
+}
+
+func (d *SlowQueryDetector) addLocked(s SlowQuerySample) {
+	if len(d.ring) < cap(d.ring) {
+		d.ring = append(d.ring, s)
+		return
+	}
+	d.ring[d.next] = s
+	d.next = (d.next + 1) % len(d.ring)
+}
+
+// Samples — сохранённые образцы от старых к новым.
+func (d *SlowQueryDetector) Samples() []SlowQuerySample {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make([]SlowQuerySample, 0, len(d.ring))
+	out = append(out, d.ring[d.next:]...)
+	return append(out, d.ring[:d.next]...)
+}
+
+// ServeHTTP — Samples() в JSON.
+func (d *SlowQueryDetector) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(d.Samples())
+}
+
+// Close — дождаться снятия планов из очереди (если пул уже закрыт, образцы сохраняются с ошибкой EXPLAIN).
+// Медленные запросы после Close сохраняются без плана.
+func (d *SlowQueryDetector) Close() {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.jobs)
+	}
+	d.mu.Unlock()
+	<-d.done
+}
+
+// explainable — EXPLAIN поддерживается только для SELECT/INSERT/UPDATE/DELETE/MERGE/VALUES/WITH.
+func explainable(sql string) bool {
+	switch sqlOperation(sql) {
+	case "SELECT", "INSERT", "UPDATE", "DELETE", "MERGE", "VALUES", "WITH", "TABLE":
+		return true
+	}
+	return false
+}
+
+// argsFingerprint — короткий sha256 типов и значений аргументов: одинаковые аргументы — одинаковый отпечаток,
+// а сами значения (email и т.п.) в образец не попадают.
+func argsFingerprint(args []any) string {
+	if len(args) == 0 {
+		return ""
+	}
+	h := sha256.New()
+	for _, a := range args {
+		fmt.Fprintf(h, "%T:%v\x00", a, a)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
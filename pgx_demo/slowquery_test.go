@@ -0,0 +1,135 @@
+package pgx_demo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestSlowQueryDetectorThreshold(t *testing.T) {
+	d := NewSlowQueryDetector(time.Hour, 10)
+	defer d.Close()
+
+	ctx := d.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	d.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+	if n := len(d.Samples()); n != 0 {
+		t.Fatalf("fast query recorded: %d samples", n)
+	}
+}
+
+func TestSlowQueryDetectorCapturesPlan(t *testing.T) {
+	d := NewSlowQueryDetector(0, 10)
+	var gotSQL string
+	var gotArgs []any
+	d.explain = func(_ context.Context, _ *pgxpool.Pool, sql string, args []any) (json.RawMessage, error) {
+		gotSQL, gotArgs = sql, args
+		return json.RawMessage(`[{"Plan":{"Node Type":"Index Scan"}}]`), nil
+	}
+
+	s := SlowQuerySample{SQL: psGetBalance.SQL(), StatementName: psGetBalance.Name(), ArgsFingerprint: argsFingerprint([]any{int64(1)})}
+	d.record(s, &pgxpool.Pool{}, []any{int64(1)})
+	d.Close() // дожидаемся EXPLAIN
+
+	got := d.Samples()
+	if len(got) != 1 || string(got[0].Plan) != `[{"Plan":{"Node Type":"Index Scan"}}]` || got[0].PlanErr != "" {
+		t.Fatalf("samples = %+v", got)
+	}
+	if gotSQL != psGetBalance.SQL() || len(gotArgs) != 1 {
+		t.Errorf("explain called with %q %v", gotSQL, gotArgs)
+	}
+}
+
+func TestSlowQueryDetectorPreparedNameAndErrors(t *testing.T) {
+	d := NewSlowQueryDetector(0, 10)
+	d.explain = func(context.Context, *pgxpool.Pool, string, []any) (json.RawMessage, error) {
+		return nil, errors.New("no conn")
+	}
+
+	// Без пула (nil conn) и для не-DML план не снимается, но образец сохраняется.
+	ctx := d.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: psGetUserByEmail.Name(), Args: []any{"a@example.com"}})
+	d.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: errors.New("boom")})
+	d.record(SlowQuerySample{SQL: "SET search_path = app"}, &pgxpool.Pool{}, nil)
+	d.record(SlowQuerySample{SQL: "SELECT 1"}, &pgxpool.Pool{}, nil)
+	d.Close()
+
+	got := d.Samples()
+	if len(got) != 3 {
+		t.Fatalf("got %d samples, want 3", len(got))
+	}
+	s := got[0]
+	if s.StatementName != "ps_get_user_by_email" || s.SQL != psGetUserByEmail.SQL() || s.Err != "boom" {
+		t.Errorf("sample = %+v", s)
+	}
+	if s.ArgsFingerprint == "" || s.ArgsFingerprint != argsFingerprint([]any{"a@example.com"}) {
+		t.Errorf("fingerprint = %q", s.ArgsFingerprint)
+	}
+	if got[1].PlanErr != ErrNotExplainable.Error() || got[2].PlanErr != "no conn" {
+		t.Errorf("plan errors = %q, %q", got[1].PlanErr, got[2].PlanErr)
+	}
+}
+
+func TestSlowQueryDetectorRing(t *testing.T) {
+	d := NewSlowQueryDetector(0, 3)
+	d.Close() // без EXPLAIN: образцы сохраняются сразу
+	for _, sql := range []string{"SELECT 1", "SELECT 2", "SELECT 3", "SELECT 4"} {
+		d.record(SlowQuerySample{SQL: sql}, nil, nil)
+	}
+	got := d.Samples()
+	if len(got) != 3 || got[0].SQL != "SELECT 2" || got[2].SQL != "SELECT 4" {
+		t.Fatalf("ring = %+v, want the last 3 oldest first", got)
+	}
+
+	rec := httptest.NewRecorder()
+	d.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/slow-queries", nil))
+	var dumped []SlowQuerySample
+	if err := json.Unmarshal(rec.Body.Bytes(), &dumped); err != nil || len(dumped) != 3 {
+		t.Fatalf("dump = %s (%v)", rec.Body.String(), err)
+	}
+}
+
+func TestSlowQueryDetectorSkipsOwnExplain(t *testing.T) {
+	d := NewSlowQueryDetector(0, 10)
+	defer d.Close()
+
+	ctx := context.WithValue(context.Background(), slowExplainKey{}, true)
+	ctx = d.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "EXPLAIN (FORMAT JSON) SELECT 1"})
+	d.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+	if n := len(d.Samples()); n != 0 {
+		t.Fatalf("detector traced its own EXPLAIN: %d samples", n)
+	}
+}
+
+func TestSlowQueryDetectorBatchAndCopy(t *testing.T) {
+	d := NewSlowQueryDetector(0, 10)
+	d.Close() // без EXPLAIN: образцы сохраняются сразу
+
+	ctx := d.TraceBatchStart(context.Background(), nil, pgx.TraceBatchStartData{})
+	d.TraceBatchQuery(ctx, nil, pgx.TraceBatchQueryData{SQL: "SELECT 1"})
+	time.Sleep(5 * time.Millisecond)
+	d.TraceBatchQuery(ctx, nil, pgx.TraceBatchQueryData{SQL: psGetBalance.Name(), Args: []any{int64(1)}})
+	d.TraceBatchQuery(ctx, nil, pgx.TraceBatchQueryData{SQL: "SELECT 3"})
+	d.TraceBatchEnd(ctx, nil, pgx.TraceBatchEndData{Err: errors.New("boom")})
+
+	ctx = d.TraceCopyFromStart(context.Background(), nil, pgx.TraceCopyFromStartData{
+		TableName: pgx.Identifier{"type_samples"}, ColumnNames: []string{"i4", "note"}})
+	d.TraceCopyFromEnd(ctx, nil, pgx.TraceCopyFromEndData{})
+
+	got := d.Samples()
+	if len(got) != 2 {
+		t.Fatalf("got %d samples, want 2", len(got))
+	}
+	b := got[0]
+	if b.BatchSize != 3 || b.StatementName != psGetBalance.Name() || b.Err != "boom" || b.Duration < 5*time.Millisecond {
+		t.Errorf("batch sample = %+v", b)
+	}
+	c := got[1]
+	if c.SQL != `COPY "type_samples" ("i4", "note") FROM STDIN` || c.PlanErr != ErrNotExplainable.Error() {
+		t.Errorf("copy sample = %+v", c)
+	}
+}
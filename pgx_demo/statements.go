@@ -0,0 +1,172 @@
+// Декларативный реестр подготовленных выражений.
+// Выражение регистрируется один раз (имя + SQL) и дальше используется через типизированный хэндл Stmt:
+// опечатка в имени — это ошибка компиляции, а не «имя, улетевшее в сервер как сырой SQL».
+
+package pgx_demo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Querier — общий знаменатель *pgxpool.Pool, *pgxpool.Conn, *pgx.Conn и pgx.Tx.
+// Позволяет одной и той же функции работать и «через пул», и внутри транзакции.
+type Querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// Stmt — хэндл зарегистрированного prepared-выражения. Создаётся только через StatementRegistry.
+type Stmt struct {
+	name string
+	sql  string
+}
+
+// Name — имя prepared-выражения на сервере (его же можно класть в pgx.Batch.Queue).
+func (s Stmt) Name() string { return s.name }
+
+// SQL — исходный текст выражения.
+func (s Stmt) SQL() string { return s.sql }
+
+// Exec — выполнение prepared по имени.
+func (s Stmt) Exec(ctx context.Context, q Querier, args ...any) (pgconn.CommandTag, error) {
+	return q.Exec(ctx, s.name, args...)
+}
+
+// Query — выборка по prepared.
+func (s Stmt) Query(ctx context.Context, q Querier, args ...any) (pgx.Rows, error) {
+	return q.Query(ctx, s.name, args...)
+}
+
+// QueryRow — выборка одной строки по prepared.
+func (s Stmt) QueryRow(ctx context.Context, q Querier, args ...any) pgx.Row {
+	return q.QueryRow(ctx, s.name, args...)
+}
+
+// ErrStatementRegistry — некорректная регистрация (пустое имя/SQL, дубликат имени).
+var ErrStatementRegistry = errors.New("statement registry")
+
+// StatementRegistry — упорядоченный набор prepared-выражений.
+// Регистрация — только на этапе инициализации (package-level var / init), до создания пула:
+// на уже открытых соединениях новые выражения не появятся.
+type StatementRegistry struct {
+	stmts  []Stmt
+	byName map[string]Stmt
+	// rowChecks — проверки «структура ↔ колонки результата» по имени выражения (см. ExpectRow).
+	rowChecks map[string][]func([]pgconn.FieldDescription) error
+}
+
+// NewStatementRegistry — пустой реестр.
+func NewStatementRegistry() *StatementRegistry {
+	return &StatementRegistry{
+		byName:    make(map[string]Stmt),
+		rowChecks: make(map[string][]func([]pgconn.FieldDescription) error),
+	}
+}
+
+// Register — добавить выражение. Имя должно быть уникальным в рамках реестра.
+func (r *StatementRegistry) Register(name, sql string) (Stmt, error) {
+	if name == "" || sql == "" {
+		return Stmt{}, fmt.Errorf("%w: empty name or sql (name=%q)", ErrStatementRegistry, name)
+	}
+	if _, dup := r.byName[name]; dup {
+		return Stmt{}, fmt.Errorf("%w: duplicate statement %q", ErrStatementRegistry, name)
+	}
+	s := Stmt{name: name, sql: sql}
+	r.stmts = append(r.stmts, s)
+	r.byName[name] = s
+	return s, nil
+}
+
+// MustRegister — как Register, но паникует. Для package-level объявлений.
+func (r *StatementRegistry) MustRegister(name, sql string) Stmt {
+	s, err := r.Register(name, sql)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Lookup — поиск хэндла по имени (например, для динамических сценариев/диагностики).
+func (r *StatementRegistry) Lookup(name string) (Stmt, bool) {
+	s, ok := r.byName[name]
+	return s, ok
+}
+
+// All — копия списка выражений в порядке регистрации.
+func (r *StatementRegistry) All() []Stmt {
+	return append([]Stmt(nil), r.stmts...)
+}
+
+// PrepareAll — подготовить все выражения на соединении. Вызывается из AfterConnect.
+func (r *StatementRegistry) PrepareAll(ctx context.Context, conn *pgx.Conn) error {
+	for _, s := range r.stmts {
+		if _, err := conn.Prepare(ctx, s.name, s.sql); err != nil {
+			return fmt.Errorf("prepare %s: %w", s.name, err)
+		}
+	}
+	return nil
+}
+
+// Validate — проверка, что ВСЕ выражения парсятся против текущей схемы, а колонки результата
+// совпадают со структурами, зарегистрированными через ExpectRow.
+// Готовим каждое как unnamed ("") — на сервере ничего не остаётся, — и собираем все ошибки сразу,
+// а не только первую, как это делает AfterConnect.
+func (r *StatementRegistry) Validate(ctx context.Context, conn *pgx.Conn) error {
+	var errs []error
+	for _, s := range r.stmts {
+		sd, err := conn.Prepare(ctx, "", s.sql)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("statement %s: %w", s.name, err))
+			continue
+		}
+		for _, check := range r.rowChecks[s.name] {
+			if err := check(sd.Fields); err != nil {
+				errs = append(errs, fmt.Errorf("statement %s: %w", s.name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Statements — реестр выражений этого пакета. Каждое соединение пула из BuildPool получает их в AfterConnect.
+var Statements = NewStatementRegistry()
+
+// Хэндлы prepared-выражений пакета.
+var (
+	psInsertUser = Statements.MustRegister("ps_insert_user",
+		`INSERT INTO app_users(email, name, middle_name)
+		 VALUES ($1,$2,$3)
+		 ON CONFLICT (email) DO UPDATE SET name = EXCLUDED.name
+		 RETURNING id`)
+	psSetLastLogin = Statements.MustRegister("ps_set_last_login",
+		`UPDATE app_users SET last_login = now() WHERE id = $1`)
+	psGetUserByEmail = ExpectRow[User](Statements, Statements.MustRegister("ps_get_user_by_email",
+		`SELECT id, email, name, middle_name, last_login, is_active
+		   FROM app_users
+		  WHERE email = $1`))
+	psEnsureAccount = Statements.MustRegister("ps_ensure_account",
+		`INSERT INTO accounts(user_id, balance)
+		 VALUES ($1, 0)
+		 ON CONFLICT (user_id) DO NOTHING`)
+	psGetBalance = Statements.MustRegister("ps_get_balance",
+		`SELECT balance FROM accounts WHERE user_id = $1`)
+	psSelectUsersLight = Statements.MustRegister("ps_select_users_light",
+		`SELECT id, email, name FROM app_users ORDER BY id LIMIT 5`)
+	psGetUserIdByEmail = Statements.MustRegister("ps_get_user_id_by_email",
+		`SELECT id FROM app_users WHERE email = $1`)
+	// Для демонстрации типов и NULL-обработки на отдельной таблице
+	psInsertTypeSample = Statements.MustRegister("ps_insert_type_sample",
+		`INSERT INTO type_samples(uid, i2, i4, i8, flag, note, num, ts)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+		 RETURNING id`)
+	psGetTypeSample = ExpectRow[TypeSample](Statements, Statements.MustRegister("ps_get_type_sample",
+		`SELECT uid, i2, i4, i8, flag, note, num, ts
+		   FROM type_samples
+		  WHERE id = $1`))
+)
@@ -0,0 +1,48 @@
+package pgx_demo
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStatementRegistryRegister(t *testing.T) {
+	r := NewStatementRegistry()
+	a := r.MustRegister("ps_a", "SELECT 1")
+	r.MustRegister("ps_b", "SELECT 2")
+
+	if a.Name() != "ps_a" || a.SQL() != "SELECT 1" {
+		t.Fatalf("stmt = %q/%q", a.Name(), a.SQL())
+	}
+	if got, ok := r.Lookup("ps_b"); !ok || got.SQL() != "SELECT 2" {
+		t.Fatalf("Lookup(ps_b) = %v, %v", got, ok)
+	}
+	if _, ok := r.Lookup("ps_missing"); ok {
+		t.Fatal("Lookup(ps_missing) found a statement")
+	}
+	all := r.All()
+	if len(all) != 2 || all[0].Name() != "ps_a" || all[1].Name() != "ps_b" {
+		t.Fatalf("All() = %v, want registration order", all)
+	}
+
+	if _, err := r.Register("ps_a", "SELECT 3"); !errors.Is(err, ErrStatementRegistry) {
+		t.Errorf("duplicate: err = %v", err)
+	}
+	if _, err := r.Register("", "SELECT 3"); !errors.Is(err, ErrStatementRegistry) {
+		t.Errorf("empty name: err = %v", err)
+	}
+	if _, err := r.Register("ps_c", ""); !errors.Is(err, ErrStatementRegistry) {
+		t.Errorf("empty sql: err = %v", err)
+	}
+}
+
+func TestPackageStatementsRegistered(t *testing.T) {
+	for _, name := range []string{
+		"ps_insert_user", "ps_set_last_login", "ps_get_user_by_email", "ps_get_user_id_by_email",
+		"ps_ensure_account", "ps_get_balance", "ps_select_users_light",
+		"ps_insert_type_sample", "ps_get_type_sample",
+	} {
+		if _, ok := Statements.Lookup(name); !ok {
+			t.Errorf("statement %s is not registered", name)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+// TenantPools — по пулу на арендатора (tenant) поверх BuildPool, с изоляцией через схему или роль.
+// Пул создаётся лениво при первом ForTenant; каждое его соединение настраивается WithSessionInit:
+//   - TenantSchema — SET search_path TO <схема арендатора>: одни и те же prepared-выражения реестра
+//     Statements на каждом соединении разрешаются в таблицы своей схемы;
+//   - TenantRole — SET ROLE <роль арендатора>: изоляция правами (GRANT/RLS) в общей схеме.
+//
+// Глобальный бюджет соединений (TenantOptions.Budget) делится на пулы по ConnsPerTenant:
+// когда места нет, закрывается давно не использовавшийся пул без выданных соединений.
+//
+//	tenants := NewTenantPools(dsn, TenantOptions{Isolation: TenantSchema, Budget: 40})
+//	pool, err := tenants.ForTenant(ctx, "acme") // search_path = tenant_acme
+//	bal, err := GetBalance(ctx, pool, userID)
+
+package pgx_demo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// TenantIsolation — способ изоляции арендатора на уровне сессии.
+type TenantIsolation int
+
+const (
+	// TenantSchema — своя схема: SET search_path TO <имя>.
+	TenantSchema TenantIsolation = iota
+	// TenantRole — своя роль: SET ROLE <имя>. Пользователь из DSN должен быть членом роли.
+	TenantRole
+)
+
+var (
+	// ErrTenantID — пустой идентификатор арендатора.
+	ErrTenantID = errors.New("empty tenant id")
+	// ErrTenantBudget — бюджет соединений исчерпан, и ни один пул нельзя закрыть.
+	ErrTenantBudget = errors.New("tenant connection budget exhausted")
+	// ErrTenantPoolsClosed — ForTenant после Close.
+	ErrTenantPoolsClosed = errors.New("tenant pools closed")
+)
+
+// TenantOptions — настройки TenantPools.
+type TenantOptions struct {
+	Isolation TenantIsolation
+	// Name — имя схемы/роли для арендатора. По умолчанию "tenant_" + id.
+	// Имя экранируется как идентификатор, так что id из запроса SQL-инъекцией не станет.
+	Name func(id string) string
+	// ConnsPerTenant — MaxConns пула арендатора. По умолчанию 4.
+	ConnsPerTenant int32
+	// Budget — сколько соединений всего могут держать пулы арендаторов. 0 — без ограничения.
+	Budget int32
+	// EvictAfter — пул, которым не пользовались дольше, можно закрыть ради нового. По умолчанию 30s.
+	// Защищает пул, только что отданный из ForTenant, но ещё не успевший взять соединение.
+	EvictAfter time.Duration
+	// PoolOptions — опции BuildPool для каждого пула (MaxConns перекрывается ConnsPerTenant).
+	PoolOptions []PoolOption
+}
+
+const (
+	defaultConnsPerTenant   int32 = 4
+	defaultTenantEvictAfter       = 30 * time.Second
+)
+
+// TenantPools — ленивые пулы арендаторов под общим бюджетом соединений.
+type TenantPools struct {
+	dsn  string
+	opts TenantOptions
+
+	mu     sync.Mutex
+	pools  map[string]*tenantPool
+	closed bool
+
+	// build и now подменяются в тестах.
+	build func(ctx context.Context, dsn string, opts ...PoolOption) (*pgxpool.Pool, error)
+	now   func() time.Time
+}
+
+type tenantPool struct {
+	pool     *pgxpool.Pool
+	lastUsed time.Time
+}
+
+// NewTenantPools — менеджер без пулов; DSN проверяется при создании первого пула.
+func NewTenantPools(dsn string, opts TenantOptions) *TenantPools {
+	if opts.Name == nil {
+		opts.Name = func(id string) string { return "tenant_" + id }
+	}
+	if opts.ConnsPerTenant <= 0 {
+		opts.ConnsPerTenant = defaultConnsPerTenant
+	}
+	if opts.EvictAfter <= 0 {
+		opts.EvictAfter = defaultTenantEvictAfter
+	}
+	return &TenantPools{
+		dsn:   dsn,
+		opts:  opts,
+		pools: make(map[string]*tenantPool),
+		build: BuildPool,
+		now:   time.Now,
+	}
+}
+
+// ForTenant — пул арендатора id; создаётся при первом обращении.
+// Пул не закрывается, пока на нём есть выданные соединения, поэтому брать соединение
+// стоит сразу, а не хранить пул между запросами.
+func (t *TenantPools) ForTenant(ctx context.Context, id string) (*pgxpool.Pool, error) {
+	if id == "" {
+		return nil, ErrTenantID
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil, ErrTenantPoolsClosed
+	}
+	now := t.now()
+	if tp, ok := t.pools[id]; ok {
+		tp.lastUsed = now
+		return tp.pool, nil
+	}
+	if !t.makeRoom(now) {
+		return nil, fmt.Errorf("%w: tenant %q, %d pools x %d conns", ErrTenantBudget, id, len(t.pools), t.opts.ConnsPerTenant)
+	}
+	// NewWithConfig не ждёт подключения, так что держать мьютекс на время сборки пула дёшево.
+	opts := append(append([]PoolOption(nil), t.opts.PoolOptions...),
+		WithMaxConns(t.opts.ConnsPerTenant),
+		WithSessionInit(t.sessionInit(id)))
+	pool, err := t.build(ctx, t.dsn, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("tenant %q: %w", id, err)
+	}
+	t.pools[id] = &tenantPool{pool: pool, lastUsed: now}
+	return pool, nil
+}
+
+// sessionInit — команда изоляции для арендатора id.
+func (t *TenantPools) sessionInit(id string) string {
+	name := pgx.Identifier{t.opts.Name(id)}.Sanitize()
+	if t.opts.Isolation == TenantRole {
+		return "SET ROLE " + name
+	}
+	return "SET search_path TO " + name
+}
+
+// makeRoom — освобождает место под ещё один пул; false — бюджет исчерпан. Вызывается под t.mu.
+func (t *TenantPools) makeRoom(now time.Time) bool {
+	if t.opts.Budget <= 0 {
+		return true
+	}
+	for int32(len(t.pools)+1)*t.opts.ConnsPerTenant > t.opts.Budget {
+		victim, ok := t.idlest(now)
+		if !ok {
+			return false
+		}
+		pool := t.pools[victim].pool
+		delete(t.pools, victim)
+		// Close ждёт возврата соединений — не держим мьютекс.
+		go pool.Close()
+	}
+	return true
+}
+
+// idlest — давнее всех использованный пул без выданных соединений, простаивающий дольше EvictAfter.
+func (t *TenantPools) idlest(now time.Time) (string, bool) {
+	var (
+		victim string
+		oldest time.Time
+	)
+	for id, tp := range t.pools {
+		if now.Sub(tp.lastUsed) < t.opts.EvictAfter || tp.pool.Stat().AcquiredConns() > 0 {
+			continue
+		}
+		if victim == "" || tp.lastUsed.Before(oldest) {
+			victim, oldest = id, tp.lastUsed
+		}
+	}
+	return victim, victim != ""
+}
+
+// Tenants — арендаторы с открытыми пулами.
+func (t *TenantPools) Tenants() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ids := make([]string, 0, len(t.pools))
+	for id := range t.pools {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Close — закрывает все пулы; дальнейшие ForTenant возвращают ErrTenantPoolsClosed.
+func (t *TenantPools) Close() {
+	t.mu.Lock()
+	pools := t.pools
+	t.pools = make(map[string]*tenantPool)
+	t.closed = true
+	t.mu.Unlock()
+	for _, tp := range pools {
+		tp.pool.Close()
+	}
+}
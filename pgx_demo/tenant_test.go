@@ -0,0 +1,103 @@
+package pgx_demo
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// tenantHarness — TenantPools с ленивыми пулами (без подключения к БД) и ручными часами.
+func tenantHarness(t *testing.T, opts TenantOptions) (*TenantPools, *time.Time, *int) {
+	t.Helper()
+	tp := NewTenantPools(testDSN, opts)
+	built := 0
+	tp.build = func(ctx context.Context, dsn string, o ...PoolOption) (*pgxpool.Pool, error) {
+		built++
+		return BuildPool(ctx, dsn, append(o, WithMinConns(0), WithMinIdleConns(0))...)
+	}
+	now := time.Unix(1000, 0)
+	tp.now = func() time.Time { return now }
+	t.Cleanup(tp.Close)
+	return tp, &now, &built
+}
+
+func TestTenantPoolsLazyPerTenant(t *testing.T) {
+	tp, _, built := tenantHarness(t, TenantOptions{ConnsPerTenant: 3})
+	ctx := context.Background()
+
+	a1, err := tp.ForTenant(ctx, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a2, _ := tp.ForTenant(ctx, "acme")
+	b, _ := tp.ForTenant(ctx, "globex")
+	if a1 != a2 || a1 == b || *built != 2 {
+		t.Fatalf("same tenant must share a pool: a1=%p a2=%p b=%p built=%d", a1, a2, b, *built)
+	}
+	if got := a1.Config().MaxConns; got != 3 {
+		t.Errorf("MaxConns = %d, want ConnsPerTenant", got)
+	}
+	ids := tp.Tenants()
+	sort.Strings(ids)
+	if len(ids) != 2 || ids[0] != "acme" || ids[1] != "globex" {
+		t.Errorf("Tenants() = %v", ids)
+	}
+
+	if _, err := tp.ForTenant(ctx, ""); !errors.Is(err, ErrTenantID) {
+		t.Errorf("empty id: err = %v", err)
+	}
+	tp.Close()
+	if _, err := tp.ForTenant(ctx, "acme"); !errors.Is(err, ErrTenantPoolsClosed) {
+		t.Errorf("after Close: err = %v", err)
+	}
+}
+
+func TestTenantSessionInit(t *testing.T) {
+	schema := NewTenantPools(testDSN, TenantOptions{})
+	if got := schema.sessionInit("acme"); got != `SET search_path TO "tenant_acme"` {
+		t.Errorf("schema isolation: %s", got)
+	}
+	role := NewTenantPools(testDSN, TenantOptions{Isolation: TenantRole, Name: func(id string) string { return id + "_rw" }})
+	if got := role.sessionInit("acme"); got != `SET ROLE "acme_rw"` {
+		t.Errorf("role isolation: %s", got)
+	}
+	if got := schema.sessionInit(`x"; DROP TABLE app_users; --`); got != `SET search_path TO "tenant_x""; DROP TABLE app_users; --"` {
+		t.Errorf("tenant id must be quoted as identifier: %s", got)
+	}
+}
+
+func TestTenantPoolsBudgetEviction(t *testing.T) {
+	tp, now, _ := tenantHarness(t, TenantOptions{ConnsPerTenant: 2, Budget: 4, EvictAfter: time.Minute})
+	ctx := context.Background()
+
+	a, _ := tp.ForTenant(ctx, "a")
+	*now = now.Add(10 * time.Second)
+	if _, err := tp.ForTenant(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Бюджет на 2 пула, оба использовались недавно — закрывать нечего.
+	*now = now.Add(10 * time.Second)
+	if _, err := tp.ForTenant(ctx, "c"); !errors.Is(err, ErrTenantBudget) {
+		t.Fatalf("err = %v, want ErrTenantBudget", err)
+	}
+
+	// Через EvictAfter вытесняется давнее всех использованный пул — "a".
+	*now = now.Add(time.Minute)
+	if _, err := tp.ForTenant(ctx, "c"); err != nil {
+		t.Fatal(err)
+	}
+	ids := tp.Tenants()
+	sort.Strings(ids)
+	if len(ids) != 2 || ids[0] != "b" || ids[1] != "c" {
+		t.Fatalf("Tenants() = %v, want [b c]", ids)
+	}
+	*now = now.Add(time.Minute)
+	if a2, _ := tp.ForTenant(ctx, "a"); a2 == a {
+		t.Error("evicted tenant must get a fresh pool")
+	}
+}
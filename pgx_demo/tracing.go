@@ -0,0 +1,274 @@
+// Трассировка запросов: SpanTracer реализует pgx.QueryTracer, BatchTracer, CopyFromTracer,
+// PrepareTracer и ConnectTracer и превращает каждый вызов в Span.
+// Модель спана повторяет OpenTelemetry (время начала/конца, родитель, атрибуты по semconv, ошибка),
+// но без зависимости от SDK: спаны отдаются в SpanRecorder. Адаптер к OTel — это SpanRecorder,
+// который создаёт otel-спан с trace.WithTimestamp(s.Start) и завершает его с trace.WithTimestamp(s.End).
+//
+// Подключение: BuildPool(ctx, dsn, WithTracer(NewSpanTracer(rec, nil))).
+
+package pgx_demo
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Ключи атрибутов. db.* и server.* — из OpenTelemetry semantic conventions, pgx.* — свои.
+const (
+	AttrDBSystem        = "db.system"               // всегда "postgresql"
+	AttrDBStatement     = "db.statement"            // текст SQL (для prepared — из реестра)
+	AttrDBOperation     = "db.operation"            // первое слово SQL: SELECT, INSERT, ...
+	AttrDBName          = "db.name"                 // база при Connect
+	AttrDBTable         = "db.sql.table"            // таблица CopyFrom
+	AttrDBStatusCode    = "db.response.status_code" // SQLSTATE при ошибке Postgres
+	AttrServerAddress   = "server.address"
+	AttrServerPort      = "server.port"
+	AttrStatementName   = "pgx.statement.name" // имя prepared-выражения (ps_insert_user, ...)
+	AttrRowsAffected    = "pgx.rows_affected"
+	AttrBatchSize       = "pgx.batch.size"
+	AttrAlreadyPrepared = "pgx.prepare.already_prepared"
+)
+
+// Span — завершённая операция. ParentID == 0 — корневой спан.
+type Span struct {
+	ID       uint64
+	ParentID uint64
+	Name     string
+	Start    time.Time
+	End      time.Time
+	Attrs    map[string]any
+	Err      error
+}
+
+// Duration — длительность спана.
+func (s Span) Duration() time.Duration { return s.End.Sub(s.Start) }
+
+// SpanRecorder — получатель завершённых спанов. Вызывается синхронно из горутины запроса,
+// поэтому реализация должна быть быстрой и потокобезопасной.
+type SpanRecorder interface {
+	RecordSpan(Span)
+}
+
+// SpanRecorderFunc — функция как SpanRecorder.
+type SpanRecorderFunc func(Span)
+
+func (f SpanRecorderFunc) RecordSpan(s Span) { f(s) }
+
+// InMemorySpanRecorder — копит спаны в памяти. Для тестов и отладки.
+type InMemorySpanRecorder struct {
+	mu    sync.Mutex
+	spans []Span
+}
+
+func (r *InMemorySpanRecorder) RecordSpan(s Span) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+// Spans — копия записанных спанов в порядке завершения.
+func (r *InMemorySpanRecorder) Spans() []Span {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Span(nil), r.spans...)
+}
+
+// Reset — забыть записанные спаны.
+func (r *InMemorySpanRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = nil
+}
+
+// SpanTracer — трассировщик pgx. Создаётся через NewSpanTracer.
+type SpanTracer struct {
+	rec    SpanRecorder
+	reg    *StatementRegistry
+	lastID atomic.Uint64
+}
+
+// NewSpanTracer — трассировщик, пишущий в rec. reg нужен, чтобы по имени prepared-выражения
+// показать его SQL; nil — реестр пакета Statements.
+func NewSpanTracer(rec SpanRecorder, reg *StatementRegistry) *SpanTracer {
+	if reg == nil {
+		reg = Statements
+	}
+	return &SpanTracer{rec: rec, reg: reg}
+}
+
+var (
+	_ pgx.QueryTracer    = (*SpanTracer)(nil)
+	_ pgx.BatchTracer    = (*SpanTracer)(nil)
+	_ pgx.CopyFromTracer = (*SpanTracer)(nil)
+	_ pgx.PrepareTracer  = (*SpanTracer)(nil)
+	_ pgx.ConnectTracer  = (*SpanTracer)(nil)
+)
+
+type spanKey struct{}
+
+// activeSpan — незавершённый спан в контексте между Trace*Start и Trace*End.
+type activeSpan struct {
+	Span
+	// mu/lastEnd — только для батча: TraceBatchQuery вызывается по мере чтения результатов.
+	mu      sync.Mutex
+	lastEnd time.Time
+}
+
+func (t *SpanTracer) start(ctx context.Context, name string, attrs map[string]any) context.Context {
+	s := &activeSpan{Span: Span{ID: t.lastID.Add(1), Name: name, Start: time.Now(), Attrs: attrs}}
+	if parent, ok := ctx.Value(spanKey{}).(*activeSpan); ok {
+		s.ParentID = parent.ID
+	}
+	s.Attrs[AttrDBSystem] = "postgresql"
+	s.lastEnd = s.Start
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+func (t *SpanTracer) end(ctx context.Context, err error) {
+	s, ok := ctx.Value(spanKey{}).(*activeSpan)
+	if !ok {
+		return
+	}
+	s.End = time.Now()
+	setErr(&s.Span, err)
+	t.rec.RecordSpan(s.Span)
+}
+
+// setErr — ошибка спана и её SQLSTATE.
+func setErr(s *Span, err error) {
+	if err == nil {
+		return
+	}
+	s.Err = err
+	var pge *pgconn.PgError
+	if errors.As(err, &pge) {
+		s.Attrs[AttrDBStatusCode] = pge.Code
+	}
+}
+
+// statementAttrs — атрибуты запроса. Если sql — имя зарегистрированного выражения,
+// спан называется именем выражения, а в db.statement попадает его SQL.
+func (t *SpanTracer) statementAttrs(sql string) (name string, attrs map[string]any) {
+	attrs = make(map[string]any)
+	if st, ok := t.reg.Lookup(sql); ok {
+		attrs[AttrStatementName] = st.Name()
+		sql = st.SQL()
+		name = st.Name()
+	}
+	op := sqlOperation(sql)
+	if name == "" {
+		name = op
+	}
+	attrs[AttrDBStatement] = sql
+	attrs[AttrDBOperation] = op
+	return name, attrs
+}
+
+// sqlOperation — первое слово SQL в верхнем регистре.
+func sqlOperation(sql string) string {
+	f := strings.Fields(sql)
+	if len(f) == 0 {
+		return "QUERY"
+	}
+	return strings.ToUpper(f[0])
+}
+
+// TraceQueryStart/TraceQueryEnd — Exec/Query/QueryRow.
+func (t *SpanTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	name, attrs := t.statementAttrs(data.SQL)
+	return t.start(ctx, name, attrs)
+}
+
+func (t *SpanTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	if s, ok := ctx.Value(spanKey{}).(*activeSpan); ok && data.Err == nil {
+		s.Attrs[AttrRowsAffected] = data.CommandTag.RowsAffected()
+	}
+	t.end(ctx, data.Err)
+}
+
+// TraceBatchStart/TraceBatchQuery/TraceBatchEnd — SendBatch: спан "batch" и дочерний спан на каждый элемент.
+// Элементы батча выполняются конвейером, поэтому длительность элемента — время от конца предыдущего
+// до получения его результата, а не чистое время выполнения на сервере.
+func (t *SpanTracer) TraceBatchStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchStartData) context.Context {
+	return t.start(ctx, "batch", map[string]any{AttrBatchSize: data.Batch.Len()})
+}
+
+func (t *SpanTracer) TraceBatchQuery(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchQueryData) {
+	batch, ok := ctx.Value(spanKey{}).(*activeSpan)
+	if !ok {
+		return
+	}
+	name, attrs := t.statementAttrs(data.SQL)
+	now := time.Now()
+	batch.mu.Lock()
+	start := batch.lastEnd
+	batch.lastEnd = now
+	batch.mu.Unlock()
+
+	s := Span{ID: t.lastID.Add(1), ParentID: batch.ID, Name: name, Start: start, End: now, Attrs: attrs}
+	s.Attrs[AttrDBSystem] = "postgresql"
+	if data.Err == nil {
+		s.Attrs[AttrRowsAffected] = data.CommandTag.RowsAffected()
+	}
+	setErr(&s, data.Err)
+	t.rec.RecordSpan(s)
+}
+
+func (t *SpanTracer) TraceBatchEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchEndData) {
+	t.end(ctx, data.Err)
+}
+
+// TraceCopyFromStart/TraceCopyFromEnd — CopyFrom.
+func (t *SpanTracer) TraceCopyFromStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceCopyFromStartData) context.Context {
+	return t.start(ctx, "copy_from", map[string]any{
+		AttrDBOperation: "COPY",
+		AttrDBTable:     data.TableName.Sanitize(),
+	})
+}
+
+func (t *SpanTracer) TraceCopyFromEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceCopyFromEndData) {
+	if s, ok := ctx.Value(spanKey{}).(*activeSpan); ok && data.Err == nil {
+		s.Attrs[AttrRowsAffected] = data.CommandTag.RowsAffected()
+	}
+	t.end(ctx, data.Err)
+}
+
+// TracePrepareStart/TracePrepareEnd — Prepare (в т.ч. Statements.PrepareAll из AfterConnect).
+// Спан connect к этим prepare отношения не имеет: pgxpool вызывает AfterConnect с контекстом создания
+// соединения, а не с тем, что вернул TraceConnectStart, поэтому они — отдельные спаны, а не дочерние.
+func (t *SpanTracer) TracePrepareStart(ctx context.Context, _ *pgx.Conn, data pgx.TracePrepareStartData) context.Context {
+	return t.start(ctx, "prepare", map[string]any{
+		AttrStatementName: data.Name,
+		AttrDBStatement:   data.SQL,
+		AttrDBOperation:   "PREPARE",
+	})
+}
+
+func (t *SpanTracer) TracePrepareEnd(ctx context.Context, _ *pgx.Conn, data pgx.TracePrepareEndData) {
+	if s, ok := ctx.Value(spanKey{}).(*activeSpan); ok {
+		s.Attrs[AttrAlreadyPrepared] = data.AlreadyPrepared
+	}
+	t.end(ctx, data.Err)
+}
+
+// TraceConnectStart/TraceConnectEnd — установка нового соединения пула.
+func (t *SpanTracer) TraceConnectStart(ctx context.Context, data pgx.TraceConnectStartData) context.Context {
+	cc := data.ConnConfig
+	return t.start(ctx, "connect", map[string]any{
+		AttrServerAddress: cc.Host,
+		AttrServerPort:    strconv.Itoa(int(cc.Port)),
+		AttrDBName:        cc.Database,
+	})
+}
+
+func (t *SpanTracer) TraceConnectEnd(ctx context.Context, data pgx.TraceConnectEndData) {
+	t.end(ctx, data.Err)
+}
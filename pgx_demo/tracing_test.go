@@ -0,0 +1,117 @@
+package pgx_demo
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestSpanTracerQuery(t *testing.T) {
+	rec := &InMemorySpanRecorder{}
+	tr := NewSpanTracer(rec, nil)
+	ctx := context.Background()
+
+	// Вызов prepared по имени: спан называется именем выражения, SQL берётся из реестра.
+	qctx := tr.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: psGetBalance.Name()})
+	tr.TraceQueryEnd(qctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("SELECT 1")})
+
+	qctx = tr.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "insert into t values (1)"})
+	tr.TraceQueryEnd(qctx, nil, pgx.TraceQueryEndData{Err: &pgconn.PgError{Code: "23505"}})
+
+	spans := rec.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	s := spans[0]
+	if s.Name != "ps_get_balance" || s.Attrs[AttrStatementName] != "ps_get_balance" ||
+		s.Attrs[AttrDBStatement] != psGetBalance.SQL() || s.Attrs[AttrDBOperation] != "SELECT" {
+		t.Errorf("prepared span = %+v", s)
+	}
+	if s.Attrs[AttrRowsAffected] != int64(1) || s.Err != nil || s.End.Before(s.Start) {
+		t.Errorf("prepared span result = %+v", s)
+	}
+
+	s = spans[1]
+	if s.Name != "INSERT" || s.Attrs[AttrDBStatusCode] != "23505" || s.Err == nil {
+		t.Errorf("failed span = %+v", s)
+	}
+	if _, ok := s.Attrs[AttrRowsAffected]; ok {
+		t.Error("failed query must not report rows affected")
+	}
+}
+
+func TestSpanTracerBatchChildren(t *testing.T) {
+	rec := &InMemorySpanRecorder{}
+	tr := NewSpanTracer(rec, nil)
+
+	b := &pgx.Batch{}
+	b.Queue(psInsertUser.Name())
+	b.Queue(psSetLastLoginByEmail.Name())
+	ctx := tr.TraceBatchStart(context.Background(), nil, pgx.TraceBatchStartData{Batch: b})
+	tr.TraceBatchQuery(ctx, nil, pgx.TraceBatchQueryData{SQL: psInsertUser.Name(), CommandTag: pgconn.NewCommandTag("INSERT 0 1")})
+	tr.TraceBatchQuery(ctx, nil, pgx.TraceBatchQueryData{SQL: psSetLastLoginByEmail.Name(), Err: errors.New("boom")})
+	tr.TraceBatchEnd(ctx, nil, pgx.TraceBatchEndData{Err: errors.New("boom")})
+
+	spans := rec.Spans()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(spans))
+	}
+	batch := spans[2]
+	if batch.Name != "batch" || batch.Attrs[AttrBatchSize] != 2 || batch.Err == nil {
+		t.Errorf("batch span = %+v", batch)
+	}
+	for i, want := range []string{"ps_insert_user", "ps_set_last_login_by_email"} {
+		if spans[i].Name != want || spans[i].ParentID != batch.ID {
+			t.Errorf("child %d = %s (parent %d), want %s (parent %d)", i, spans[i].Name, spans[i].ParentID, want, batch.ID)
+		}
+	}
+	if !spans[1].Start.Equal(spans[0].End) {
+		t.Error("pipelined child must start where the previous one ended")
+	}
+}
+
+func TestSpanTracerCopyPrepareConnect(t *testing.T) {
+	rec := &InMemorySpanRecorder{}
+	tr := NewSpanTracer(rec, nil)
+	ctx := context.Background()
+
+	c := tr.TraceConnectStart(ctx, pgx.TraceConnectStartData{ConnConfig: &pgx.ConnConfig{Config: pgconn.Config{Host: "db", Port: 5432, Database: "app"}}})
+	tr.TraceConnectEnd(c, pgx.TraceConnectEndData{})
+	p := tr.TracePrepareStart(ctx, nil, pgx.TracePrepareStartData{Name: "ps_x", SQL: "SELECT 1"})
+	tr.TracePrepareEnd(p, nil, pgx.TracePrepareEndData{AlreadyPrepared: true})
+
+	cp := tr.TraceCopyFromStart(ctx, nil, pgx.TraceCopyFromStartData{TableName: pgx.Identifier{"type_samples"}})
+	tr.TraceCopyFromEnd(cp, nil, pgx.TraceCopyFromEndData{CommandTag: pgconn.NewCommandTag("COPY 100")})
+
+	spans := rec.Spans()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(spans))
+	}
+	conn, prep, cpy := spans[0], spans[1], spans[2]
+	if prep.Name != "prepare" || prep.Attrs[AttrStatementName] != "ps_x" || prep.Attrs[AttrAlreadyPrepared] != true {
+		t.Errorf("prepare span = %+v", prep)
+	}
+	if conn.Name != "connect" || conn.Attrs[AttrServerAddress] != "db" || conn.Attrs[AttrServerPort] != "5432" || conn.Attrs[AttrDBName] != "app" {
+		t.Errorf("connect span = %+v", conn)
+	}
+	if cpy.Name != "copy_from" || cpy.Attrs[AttrDBTable] != `"type_samples"` || cpy.Attrs[AttrRowsAffected] != int64(100) {
+		t.Errorf("copy span = %+v", cpy)
+	}
+}
+
+func TestWithTracerCombinesWithMetrics(t *testing.T) {
+	cfg, err := BuildPoolConfig(testDSN, WithTracer(NewSpanTracer(&InMemorySpanRecorder{}, nil)), WithMetrics(NewPoolMetrics("main")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := cfg.ConnConfig.Tracer
+	if _, ok := tr.(pgx.BatchTracer); !ok {
+		t.Errorf("Tracer %T is not a BatchTracer", tr)
+	}
+	if _, ok := tr.(pgx.ConnectTracer); !ok {
+		t.Errorf("Tracer %T is not a ConnectTracer", tr)
+	}
+}
@@ -0,0 +1,55 @@
+// Перевод денег между счетами: блокировки строк в детерминированном порядке (без дедлоков),
+// REPEATABLE READ, типизированная ошибка овердрафта и автоматический повтор
+// при 40001 (serialization_failure) / 40P01 (deadlock_detected) с ограниченным backoff (см. tx.go).
+// Сам перевод — частный случай проводки в журнале (см. ledger.go).
+
+package pgx_demo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	// ErrInvalidTransfer — перевод самому себе, с/на ExternalAccount или неположительная/невалидная сумма.
+	ErrInvalidTransfer = errors.New("invalid transfer")
+	// ErrAccountNotFound — у пользователя нет счёта (см. EnsureAccount).
+	ErrAccountNotFound = errors.New("account not found")
+)
+
+// OverdraftError — на счёте списания недостаточно средств. Транзакция откатывается, повтора нет.
+type OverdraftError struct {
+	UserID  int64
+	Balance pgtype.Numeric
+	Amount  pgtype.Numeric
+}
+
+func (e *OverdraftError) Error() string {
+	return fmt.Sprintf("overdraft on account %d: balance %s, amount %s",
+		e.UserID, numericString(e.Balance), numericString(e.Amount))
+}
+
+// Transfer — перевод amount со счёта from на счёт to (проводка в журнале с memo "transfer").
+// Обе строки блокируются одним SELECT ... ORDER BY user_id FOR UPDATE: встречные переводы
+// берут блокировки в одном порядке и не дедлочат друг друга. Если сервер всё же вернул
+// 40001/40P01 — транзакция целиком повторяется по DefaultRetryPolicy (см. WithTx).
+func Transfer(ctx context.Context, pool *pgxpool.Pool, from, to int64, amount pgtype.Numeric) error {
+	if from == ExternalAccount || to == ExternalAccount {
+		return fmt.Errorf("%w: transfer requires two user accounts", ErrInvalidTransfer)
+	}
+	_, err := PostEntry(ctx, pool, Posting{Debit: from, Credit: to, Amount: amount, Memo: "transfer"})
+	return err
+}
+
+// numericString — человекочитаемое значение pgtype.Numeric для сообщений об ошибках.
+func numericString(n pgtype.Numeric) string {
+	v, err := n.Value()
+	if err != nil || v == nil {
+		return "NULL"
+	}
+	return v.(string)
+}
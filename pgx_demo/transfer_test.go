@@ -0,0 +1,47 @@
+package pgx_demo
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestTransferRejectsInvalidInput(t *testing.T) {
+	ctx := context.Background()
+	ten := pgtype.Numeric{Int: big.NewInt(1000), Exp: -2, Valid: true}
+
+	// До пула дело не доходит, поэтому nil-пул здесь безопасен.
+	cases := map[string]struct {
+		from, to int64
+		amount   pgtype.Numeric
+	}{
+		"same account": {1, 1, ten},
+		"external":     {ExternalAccount, 2, ten},
+		"null amount":  {1, 2, pgtype.Numeric{}},
+		"zero amount":  {1, 2, pgtype.Numeric{Int: big.NewInt(0), Valid: true}},
+		"negative":     {1, 2, pgtype.Numeric{Int: big.NewInt(-5), Valid: true}},
+		"NaN":          {1, 2, pgtype.Numeric{NaN: true, Valid: true}},
+		"infinity":     {1, 2, pgtype.Numeric{InfinityModifier: pgtype.Infinity, Valid: true}},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if err := Transfer(ctx, nil, tc.from, tc.to, tc.amount); !errors.Is(err, ErrInvalidTransfer) {
+				t.Fatalf("err = %v, want ErrInvalidTransfer", err)
+			}
+		})
+	}
+}
+
+func TestOverdraftErrorMessage(t *testing.T) {
+	err := &OverdraftError{
+		UserID:  7,
+		Balance: pgtype.Numeric{Int: big.NewInt(500), Exp: -2, Valid: true},
+		Amount:  pgtype.Numeric{Int: big.NewInt(1000), Exp: -2, Valid: true},
+	}
+	if got, want := err.Error(), "overdraft on account 7: balance 5.00, amount 10.00"; got != want {
+		t.Fatalf("Error() = %q, want %q", got, want)
+	}
+}
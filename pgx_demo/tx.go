@@ -0,0 +1,147 @@
+// Обобщённый помощник транзакций: WithTx(ctx, db, opts, fn).
+// Вместо ручного Begin / defer Rollback / Commit в каждой функции:
+//   - уровень изоляции, read-only и deferrable через pgx.TxOptions;
+//   - вложенный вызов с уже открытой pgx.Tx превращается в SAVEPOINT;
+//   - паника внутри fn откатывает транзакцию и пробрасывается дальше;
+//   - подключаемая политика повторов (конфликты сериализации, дедлоки, потеря соединения).
+
+package pgx_demo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/MrTeeett/pgx-v5-pool-examples/pgx_demo/pgerr"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrTxCommitUnknown — соединение пропало во время COMMIT: транзакция могла как примениться,
+// так и нет. Такие ошибки WithTx НИКОГДА не повторяет, независимо от политики.
+var ErrTxCommitUnknown = errors.New("transaction commit outcome unknown")
+
+// TxStarter — всё, у чего есть Begin: *pgxpool.Pool, *pgxpool.Conn, *pgx.Conn и pgx.Tx (вложенность через SAVEPOINT).
+type TxStarter interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// RetryPolicy решает, повторять ли транзакцию после ошибки err на попытке attempt (с 1), и с какой паузой.
+type RetryPolicy interface {
+	Backoff(attempt int, err error) (delay time.Duration, retry bool)
+}
+
+// RetryPolicyFunc — адаптер функции к RetryPolicy.
+type RetryPolicyFunc func(attempt int, err error) (time.Duration, bool)
+
+func (f RetryPolicyFunc) Backoff(attempt int, err error) (time.Duration, bool) {
+	return f(attempt, err)
+}
+
+// BackoffRetry — повтор повторяемых ошибок (pgerr.IsRetryable) с экспоненциальной паузой и «полным джиттером».
+type BackoffRetry struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+func (r BackoffRetry) Backoff(attempt int, err error) (time.Duration, bool) {
+	if attempt >= r.MaxAttempts || !pgerr.IsRetryable(err) {
+		return 0, false
+	}
+	d := r.BaseDelay << (attempt - 1)
+	if d <= 0 || d > r.MaxDelay {
+		d = r.MaxDelay
+	}
+	if d <= 0 {
+		return 0, true
+	}
+	return time.Duration(rand.Int64N(int64(d)) + 1), true
+}
+
+// DefaultRetryPolicy — до 5 попыток, пауза 10ms..200ms.
+var DefaultRetryPolicy RetryPolicy = BackoffRetry{MaxAttempts: 5, BaseDelay: 10 * time.Millisecond, MaxDelay: 200 * time.Millisecond}
+
+// TxOptions — параметры WithTx. Retry == nil — без повторов.
+// Для вложенного вызова (db — pgx.Tx) TxOptions и Retry игнорируются: это SAVEPOINT внутри внешней транзакции.
+type TxOptions struct {
+	pgx.TxOptions
+	Retry RetryPolicy
+}
+
+// WithTx выполняет fn в транзакции: Commit при nil, Rollback при ошибке или панике.
+// Повторяется вся транзакция целиком (fn должна быть готова к повторному вызову).
+func WithTx(ctx context.Context, db TxStarter, opts TxOptions, fn func(pgx.Tx) error) error {
+	if _, nested := db.(pgx.Tx); nested {
+		return runTx(ctx, db, nil, true, fn)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := runTx(ctx, db, &opts.TxOptions, false, fn)
+		if err == nil || opts.Retry == nil || ctx.Err() != nil || errors.Is(err, ErrTxCommitUnknown) {
+			return err
+		}
+		delay, retry := opts.Retry.Backoff(attempt, err)
+		if !retry {
+			return err
+		}
+		if werr := sleepCtx(ctx, delay); werr != nil {
+			return errors.Join(err, werr)
+		}
+	}
+}
+
+// runTx — одна попытка: Begin → fn → Commit, с откатом при ошибке/панике.
+func runTx(ctx context.Context, db TxStarter, txOpts *pgx.TxOptions, nested bool, fn func(pgx.Tx) error) (err error) {
+	var tx pgx.Tx
+	if b, ok := db.(interface {
+		BeginTx(context.Context, pgx.TxOptions) (pgx.Tx, error)
+	}); ok && txOpts != nil {
+		tx, err = b.BeginTx(ctx, *txOpts)
+	} else {
+		tx, err = db.Begin(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		// Откат — на контексте без отмены: исходный ctx мог уже истечь, а соединение надо вернуть чистым.
+		if p := recover(); p != nil {
+			_ = tx.Rollback(context.WithoutCancel(ctx))
+			panic(p)
+		}
+		if err != nil {
+			_ = tx.Rollback(context.WithoutCancel(ctx))
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		// PgError на COMMIT (например, 40001 в SERIALIZABLE) — сервер транзакцию отклонил, повтор безопасен.
+		// ErrTxCommitRollback — транзакция уже была в ошибочном состоянии и откачена.
+		// Всё остальное (обрыв сети) — исход неизвестен.
+		var pge *pgconn.PgError
+		if nested || errors.As(err, &pge) || errors.Is(err, pgx.ErrTxCommitRollback) {
+			return err
+		}
+		return fmt.Errorf("%w: %w", ErrTxCommitUnknown, err)
+	}
+	return nil
+}
+
+// sleepCtx — пауза, прерываемая отменой контекста.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,196 @@
+package pgx_demo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/MrTeeett/pgx-v5-pool-examples/pgx_demo/pgerr"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// fakeTx — минимальная pgx.Tx: считает Commit/Rollback, Begin возвращает вложенную fakeTx.
+type fakeTx struct {
+	pgx.Tx
+	commitErr  error
+	commits    int
+	rollbacks  int
+	savepoints int
+}
+
+func (t *fakeTx) Begin(context.Context) (pgx.Tx, error) {
+	t.savepoints++
+	return &fakeTx{}, nil
+}
+
+func (t *fakeTx) Commit(context.Context) error {
+	t.commits++
+	return t.commitErr
+}
+
+func (t *fakeTx) Rollback(context.Context) error {
+	t.rollbacks++
+	return nil
+}
+
+// fakeStarter — «пул»: каждый BeginTx выдаёт новую fakeTx и запоминает опции.
+type fakeStarter struct {
+	commitErr error
+	txs       []*fakeTx
+	opts      []pgx.TxOptions
+}
+
+func (s *fakeStarter) Begin(ctx context.Context) (pgx.Tx, error) {
+	return s.BeginTx(ctx, pgx.TxOptions{})
+}
+
+func (s *fakeStarter) BeginTx(_ context.Context, opts pgx.TxOptions) (pgx.Tx, error) {
+	tx := &fakeTx{commitErr: s.commitErr}
+	s.txs = append(s.txs, tx)
+	s.opts = append(s.opts, opts)
+	return tx, nil
+}
+
+// noDelay — политика без пауз, чтобы тесты не спали.
+func noDelay(max int) RetryPolicy {
+	return RetryPolicyFunc(func(attempt int, err error) (time.Duration, bool) {
+		return 0, attempt < max && pgerr.IsRetryable(err)
+	})
+}
+
+func TestWithTxCommitAndRollback(t *testing.T) {
+	ctx := context.Background()
+	db := &fakeStarter{}
+
+	opts := TxOptions{TxOptions: pgx.TxOptions{IsoLevel: pgx.Serializable, AccessMode: pgx.ReadOnly, DeferrableMode: pgx.Deferrable}}
+	if err := WithTx(ctx, db, opts, func(pgx.Tx) error { return nil }); err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+	if db.txs[0].commits != 1 || db.txs[0].rollbacks != 0 {
+		t.Errorf("success: commits=%d rollbacks=%d", db.txs[0].commits, db.txs[0].rollbacks)
+	}
+	if db.opts[0] != opts.TxOptions {
+		t.Errorf("BeginTx opts = %+v, want %+v", db.opts[0], opts.TxOptions)
+	}
+
+	boom := errors.New("boom")
+	if err := WithTx(ctx, db, TxOptions{}, func(pgx.Tx) error { return boom }); !errors.Is(err, boom) {
+		t.Fatalf("err = %v, want boom", err)
+	}
+	if db.txs[1].commits != 0 || db.txs[1].rollbacks != 1 {
+		t.Errorf("failure: commits=%d rollbacks=%d", db.txs[1].commits, db.txs[1].rollbacks)
+	}
+}
+
+func TestWithTxRollsBackOnPanic(t *testing.T) {
+	db := &fakeStarter{}
+	defer func() {
+		if p := recover(); p != "oops" {
+			t.Fatalf("recover() = %v, want oops", p)
+		}
+		if db.txs[0].rollbacks != 1 || db.txs[0].commits != 0 {
+			t.Errorf("panic: commits=%d rollbacks=%d", db.txs[0].commits, db.txs[0].rollbacks)
+		}
+	}()
+	_ = WithTx(context.Background(), db, TxOptions{}, func(pgx.Tx) error { panic("oops") })
+}
+
+func TestWithTxRetries(t *testing.T) {
+	ctx := context.Background()
+
+	db := &fakeStarter{}
+	calls := 0
+	err := WithTx(ctx, db, TxOptions{Retry: noDelay(5)}, func(pgx.Tx) error {
+		calls++
+		if calls < 3 {
+			return &pgconn.PgError{Code: "40001"}
+		}
+		return nil
+	})
+	if err != nil || calls != 3 || len(db.txs) != 3 {
+		t.Fatalf("err=%v calls=%d txs=%d, want success on 3rd attempt", err, calls, len(db.txs))
+	}
+
+	// Попытки ограничены политикой.
+	calls = 0
+	err = WithTx(ctx, &fakeStarter{}, TxOptions{Retry: noDelay(2)}, func(pgx.Tx) error {
+		calls++
+		return &pgconn.PgError{Code: "40P01"}
+	})
+	if err == nil || calls != 2 {
+		t.Fatalf("err=%v calls=%d, want failure after 2 attempts", err, calls)
+	}
+
+	// Неповторяемые ошибки и отсутствие политики — одна попытка.
+	calls = 0
+	_ = WithTx(ctx, &fakeStarter{}, TxOptions{Retry: noDelay(5)}, func(pgx.Tx) error {
+		calls++
+		return &pgconn.PgError{Code: "23505"}
+	})
+	_ = WithTx(ctx, &fakeStarter{}, TxOptions{}, func(pgx.Tx) error {
+		calls++
+		return &pgconn.PgError{Code: "40001"}
+	})
+	if calls != 2 {
+		t.Fatalf("calls = %d, want 2", calls)
+	}
+}
+
+func TestWithTxNeverRetriesUnknownCommit(t *testing.T) {
+	db := &fakeStarter{commitErr: io.ErrUnexpectedEOF}
+	calls := 0
+	err := WithTx(context.Background(), db, TxOptions{Retry: noDelay(5)}, func(pgx.Tx) error {
+		calls++
+		return nil
+	})
+	if !errors.Is(err, ErrTxCommitUnknown) || calls != 1 {
+		t.Fatalf("err=%v calls=%d, want ErrTxCommitUnknown after 1 attempt", err, calls)
+	}
+
+	// Отказ сервера на COMMIT — не «неизвестный исход», его можно повторить.
+	db = &fakeStarter{commitErr: &pgconn.PgError{Code: "40001"}}
+	err = WithTx(context.Background(), db, TxOptions{Retry: noDelay(3)}, func(pgx.Tx) error { return nil })
+	if errors.Is(err, ErrTxCommitUnknown) || len(db.txs) != 3 {
+		t.Fatalf("err=%v txs=%d, want 3 attempts", err, len(db.txs))
+	}
+}
+
+func TestWithTxNestedUsesSavepoint(t *testing.T) {
+	outer := &fakeTx{}
+	called := false
+	err := WithTx(context.Background(), outer, TxOptions{Retry: noDelay(5)}, func(tx pgx.Tx) error {
+		called = true
+		if tx == outer {
+			t.Error("nested call got the outer tx, want a savepoint")
+		}
+		return nil
+	})
+	if err != nil || !called || outer.savepoints != 1 {
+		t.Fatalf("err=%v called=%v savepoints=%d", err, called, outer.savepoints)
+	}
+	if outer.commits != 0 {
+		t.Error("nested WithTx must not commit the outer tx")
+	}
+}
+
+func TestBackoffRetry(t *testing.T) {
+	p := BackoffRetry{MaxAttempts: 4, BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+	for attempt := 1; attempt < 4; attempt++ {
+		d, ok := p.Backoff(attempt, &pgconn.PgError{Code: "40001"})
+		if !ok || d <= 0 || d > p.MaxDelay {
+			t.Errorf("Backoff(%d) = %s, %v", attempt, d, ok)
+		}
+	}
+	if _, ok := p.Backoff(4, &pgconn.PgError{Code: "40001"}); ok {
+		t.Error("Backoff must stop at MaxAttempts")
+	}
+	if _, ok := p.Backoff(1, errors.New("boom")); ok {
+		t.Error("plain error must not be retried")
+	}
+	if _, ok := p.Backoff(1, io.EOF); !ok {
+		t.Error("lost connection must be retried")
+	}
+}
@@ -0,0 +1,161 @@
+// UserRepository — CRUD над app_users поверх Querier (пул, соединение или транзакция).
+// Все запросы — prepared из реестра Statements; ошибки БД классифицируются через pgerr.
+
+package pgx_demo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/MrTeeett/pgx-v5-pool-examples/pgx_demo/pgerr"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var (
+	psGetUserByID = ExpectRow[User](Statements, Statements.MustRegister("ps_get_user_by_id",
+		`SELECT id, email, name, middle_name, last_login, is_active
+		   FROM app_users
+		  WHERE id = $1`))
+	psListUsers = ExpectRow[User](Statements, Statements.MustRegister("ps_list_users",
+		`SELECT id, email, name, middle_name, last_login, is_active
+		   FROM app_users
+		  WHERE id > $1
+		  ORDER BY id
+		  LIMIT $2`))
+	psUpdateUser = ExpectRow[User](Statements, Statements.MustRegister("ps_update_user",
+		`UPDATE app_users
+		    SET email       = COALESCE($2, email),
+		        name        = COALESCE($3, name),
+		        middle_name = CASE WHEN $4::boolean THEN $5 ELSE middle_name END
+		  WHERE id = $1
+		 RETURNING id, email, name, middle_name, last_login, is_active`))
+	psDeactivateUser = Statements.MustRegister("ps_deactivate_user",
+		`UPDATE app_users SET is_active = FALSE WHERE id = $1`)
+	psDeleteUser = Statements.MustRegister("ps_delete_user",
+		`DELETE FROM app_users WHERE id = $1`)
+)
+
+var (
+	// ErrUserNotFound — пользователя с таким id/email нет.
+	ErrUserNotFound = errors.New("user not found")
+	// ErrEmptyUserUpdate — в UserUpdate не задано ни одного поля.
+	ErrEmptyUserUpdate = errors.New("empty user update")
+	// ErrInvalidPage — неположительный размер страницы в List.
+	ErrInvalidPage = errors.New("invalid page size")
+	// ErrUserHasLedger — у пользователя есть проводки в журнале: удалить его нельзя, только Deactivate.
+	ErrUserHasLedger = errors.New("user has ledger entries")
+)
+
+// User — строка app_users. Колонки сопоставляются по тегу db, а не по позиции.
+type User struct {
+	ID         int64              `db:"id"`
+	Email      string             `db:"email"`
+	Name       string             `db:"name"`
+	MiddleName pgtype.Text        `db:"middle_name"`
+	LastLogin  pgtype.Timestamptz `db:"last_login"`
+	IsActive   bool               `db:"is_active"`
+}
+
+// UserUpdate — частичное обновление: nil-поле не трогаем.
+// MiddleName различает три состояния: nil — не менять, &pgtype.Text{Valid:false} — записать NULL,
+// &pgtype.Text{String:"...", Valid:true} — записать значение.
+type UserUpdate struct {
+	Email      *string
+	Name       *string
+	MiddleName *pgtype.Text
+}
+
+// UserRepository — операции над пользователями.
+type UserRepository struct {
+	db Querier
+}
+
+// NewUserRepository — репозиторий поверх пула/соединения/транзакции.
+func NewUserRepository(db Querier) *UserRepository {
+	return &UserRepository{db: db}
+}
+
+// GetByID — пользователь по id или ErrUserNotFound.
+func (r *UserRepository) GetByID(ctx context.Context, id int64) (User, error) {
+	return collectUser(psGetUserByID.Query(ctx, r.db, id))
+}
+
+// GetByEmail — пользователь по email или ErrUserNotFound.
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (User, error) {
+	return collectUser(psGetUserByEmail.Query(ctx, r.db, email))
+}
+
+// List — страница пользователей с id > afterID по возрастанию id (keyset-пагинация).
+// next — курсор следующей страницы (передайте его как afterID) или 0, если страниц больше нет.
+func (r *UserRepository) List(ctx context.Context, afterID int64, limit int) (users []User, next int64, err error) {
+	if limit <= 0 {
+		return nil, 0, fmt.Errorf("%w: %d", ErrInvalidPage, limit)
+	}
+	// Берём на одну строку больше — так без COUNT(*) понятно, есть ли следующая страница.
+	users, err = CollectStructs[User](psListUsers.Query(ctx, r.db, afterID, limit+1))
+	if err != nil {
+		return nil, 0, pgerr.Classify(err)
+	}
+	if len(users) > limit {
+		users = users[:limit]
+		next = users[limit-1].ID
+	}
+	return users, next, nil
+}
+
+// Update — частичное обновление; возвращает пользователя после изменения.
+func (r *UserRepository) Update(ctx context.Context, id int64, u UserUpdate) (User, error) {
+	if u.Email == nil && u.Name == nil && u.MiddleName == nil {
+		return User{}, ErrEmptyUserUpdate
+	}
+	var mid pgtype.Text
+	if u.MiddleName != nil {
+		mid = *u.MiddleName
+	}
+	return collectUser(psUpdateUser.Query(ctx, r.db, id, u.Email, u.Name, u.MiddleName != nil, mid))
+}
+
+// Deactivate — мягкое отключение (is_active = FALSE); строка и счёт остаются.
+func (r *UserRepository) Deactivate(ctx context.Context, id int64) error {
+	tag, err := psDeactivateUser.Exec(ctx, r.db, id)
+	if err != nil {
+		return pgerr.Classify(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: id=%d", ErrUserNotFound, id)
+	}
+	return nil
+}
+
+// Delete — жёсткое удаление пользователя вместе со счётом. Журнал append-only и ссылается на счёт
+// с ON DELETE RESTRICT, поэтому пользователя с проводками удалить нельзя — ErrUserHasLedger
+// (вместе с pgerr.ErrForeignKey); такого пользователя отключают через Deactivate.
+func (r *UserRepository) Delete(ctx context.Context, id int64) error {
+	tag, err := psDeleteUser.Exec(ctx, r.db, id)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerr.CodeForeignKeyViolation && pgErr.TableName == "ledger_entries" {
+			return fmt.Errorf("%w: id=%d: %w", ErrUserHasLedger, id, pgerr.Classify(err))
+		}
+		return pgerr.Classify(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: id=%d", ErrUserNotFound, id)
+	}
+	return nil
+}
+
+// collectUser — ровно одна строка в User; pgx.ErrNoRows превращается в ErrUserNotFound.
+func collectUser(rows pgx.Rows, err error) (User, error) {
+	u, err := CollectOneStruct[User](rows, err)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return User{}, ErrUserNotFound
+	}
+	if err != nil {
+		return User{}, pgerr.Classify(err)
+	}
+	return u, nil
+}
@@ -0,0 +1,56 @@
+package pgx_demo
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/MrTeeett/pgx-v5-pool-examples/pgx_demo/pgerr"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestUserRepositoryValidation(t *testing.T) {
+	ctx := context.Background()
+	// До БД дело не доходит, поэтому nil-Querier здесь безопасен.
+	repo := NewUserRepository(nil)
+
+	if _, err := repo.Update(ctx, 1, UserUpdate{}); !errors.Is(err, ErrEmptyUserUpdate) {
+		t.Errorf("Update(empty) = %v, want ErrEmptyUserUpdate", err)
+	}
+	for _, limit := range []int{0, -1} {
+		if _, _, err := repo.List(ctx, 0, limit); !errors.Is(err, ErrInvalidPage) {
+			t.Errorf("List(limit=%d) = %v, want ErrInvalidPage", limit, err)
+		}
+	}
+}
+
+// execErrQuerier — Querier, у которого Exec всегда завершается ошибкой err.
+type execErrQuerier struct {
+	Querier
+	err error
+}
+
+func (q execErrQuerier) Exec(context.Context, string, ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, q.err
+}
+
+func TestUserRepositoryDeleteRefusesLedgerUsers(t *testing.T) {
+	ctx := context.Background()
+	fk := &pgconn.PgError{Code: pgerr.CodeForeignKeyViolation, TableName: "ledger_entries",
+		ConstraintName: "ledger_entries_user_id_fkey"}
+
+	err := NewUserRepository(execErrQuerier{err: fk}).Delete(ctx, 7)
+	if !errors.Is(err, ErrUserHasLedger) || !errors.Is(err, pgerr.ErrForeignKey) {
+		t.Fatalf("Delete(user with ledger) = %v, want ErrUserHasLedger and ErrForeignKey", err)
+	}
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr != fk {
+		t.Errorf("Delete must keep the *pgconn.PgError, got %v", err)
+	}
+
+	// Другие нарушения FK — не про журнал.
+	other := &pgconn.PgError{Code: pgerr.CodeForeignKeyViolation, TableName: "orders"}
+	if err := NewUserRepository(execErrQuerier{err: other}).Delete(ctx, 7); errors.Is(err, ErrUserHasLedger) || !errors.Is(err, pgerr.ErrForeignKey) {
+		t.Errorf("Delete(other fk) = %v", err)
+	}
+}